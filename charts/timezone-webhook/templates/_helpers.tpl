@@ -80,6 +80,12 @@ Defines the service name for the webhook
 {{ .Release.Name }}
 {{- end }}
 
+{{/*
+Prefixes of annotations as json array, the first one is primary, the default prefix of webhook if not set
+*/}}
+{{- define "service-webhook.annotationPrefixes" -}}
+{{- default (list "timezone.jugglechat.io") .Values.annotationPrefixes | toJson }}
+{{- end }}
 
 {{/*
 Replica for timezone-webhook deployment
@@ -0,0 +1,145 @@
+// Package cmd ...
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/m198799/timezone-webhook/internal/admission"
+)
+
+const (
+	auditTableFormat = "table"
+	auditJSONFormat  = "json"
+	auditCSVFormat   = "csv"
+)
+
+// auditOptions are the flags of audit command
+type auditOptions struct {
+	namespaces []string
+	output     string
+}
+
+var (
+	auditHandler = admission.NewRequestsHandler()
+	auditFlags   = auditOptions{output: auditTableFormat}
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report timezone coverage of pods and workloads in a live cluster, read-only",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := auditHandler.InitializeClientSet(kubeConfigFile); err != nil {
+			return err
+		}
+		entries, err := auditHandler.Audit(cmd.Context(), auditFlags.namespaces)
+		if err != nil {
+			return err
+		}
+
+		switch auditFlags.output {
+		case auditTableFormat:
+			return printAuditTable(os.Stdout, entries)
+		case auditJSONFormat:
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(entries)
+		case auditCSVFormat:
+			return printAuditCSV(os.Stdout, entries)
+		}
+		return fmt.Errorf("unknown output format %q, supported formats: %s, %s, %s", auditFlags.output, auditTableFormat, auditJSONFormat, auditCSVFormat)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringSliceVarP(&auditFlags.namespaces, "namespace", "n", auditFlags.namespaces, "Namespaces to audit, all namespaces if not specified")
+	auditCmd.Flags().StringVarP(&auditFlags.output, "output", "o", auditFlags.output, "Output format (table/json/csv)")
+	addHandlerFlags(auditCmd, &auditHandler)
+}
+
+// auditHeader is the columns of table and csv output
+var auditHeader = []string{"NAMESPACE", "KIND", "NAME", "INJECTED", "TIMEZONE", "STRATEGY", "MANUAL-TZ", "MISSING-CONFIGMAP", "INJECT-ON-RESTART", "REASON"}
+
+// auditRow format entry as columns of auditHeader
+func auditRow(entry admission.AuditEntry) []string {
+	return []string{
+		entry.Namespace, entry.Kind, entry.Name, strconv.FormatBool(entry.Injected), entry.Timezone, entry.Strategy,
+		entry.ManualTZ, strconv.FormatBool(entry.MissingConfigMap), strconv.FormatBool(entry.InjectOnRestart), entry.Reason,
+	}
+}
+
+// printAuditTable write entries and a summary per namespace
+func printAuditTable(out io.Writer, entries []admission.AuditEntry) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	writeRow := func(row []string) {
+		for i, column := range row {
+			if column == "" {
+				column = "-"
+			}
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, column)
+		}
+		fmt.Fprintln(w)
+	}
+
+	writeRow(auditHeader)
+	for _, entry := range entries {
+		writeRow(auditRow(entry))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	writeRow([]string{"NAMESPACE", "TOTAL", "INJECTED", "MANUAL-TZ", "MISSING-CONFIGMAP", "INJECT-ON-RESTART"})
+	for i := 0; i < len(entries); {
+		var (
+			namespace                                       = entries[i].Namespace
+			total, injected, manual, missing, injectRestart int
+		)
+		for ; i < len(entries) && entries[i].Namespace == namespace; i++ {
+			total++
+			if entries[i].Injected {
+				injected++
+			}
+			if entries[i].ManualTZ != "" {
+				manual++
+			}
+			if entries[i].MissingConfigMap {
+				missing++
+			}
+			if entries[i].InjectOnRestart {
+				injectRestart++
+			}
+		}
+		writeRow([]string{namespace, strconv.Itoa(total), strconv.Itoa(injected), strconv.Itoa(manual), strconv.Itoa(missing), strconv.Itoa(injectRestart)})
+	}
+	return w.Flush()
+}
+
+// printAuditCSV write entries as csv with header
+func printAuditCSV(out io.Writer, entries []admission.AuditEntry) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(auditHeader); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := w.Write(auditRow(entry)); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
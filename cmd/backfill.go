@@ -0,0 +1,39 @@
+// Package cmd ...
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/m198799/timezone-webhook/internal/admission"
+)
+
+var (
+	backfillHandler = admission.NewRequestsHandler()
+	backfillFlags   = admission.NewBackfillOptions()
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Restart running workloads whose pods are not injected, so the webhook injects them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := backfillHandler.InitializeClientSet(kubeConfigFile); err != nil {
+			return err
+		}
+		return backfillHandler.Backfill(cmd.Context(), backfillFlags, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backfillCmd)
+
+	backfillCmd.Flags().StringSliceVarP(&backfillFlags.Namespaces, "namespace", "n", backfillFlags.Namespaces, "Namespaces to backfill, all namespaces handled by webhook if not specified")
+	backfillCmd.Flags().BoolVar(&backfillFlags.DryRun, "dry-run", backfillFlags.DryRun, "Only print the workloads which would be restarted")
+	backfillCmd.Flags().DurationVar(&backfillFlags.Interval, "interval", backfillFlags.Interval, "Wait between two rollouts")
+	backfillCmd.Flags().IntVar(&backfillFlags.BatchSize, "batch-size", backfillFlags.BatchSize, "Number of namespaces rolled out in a batch")
+	backfillCmd.Flags().DurationVar(&backfillFlags.BatchInterval, "batch-interval", backfillFlags.BatchInterval, "Wait between two namespace batches")
+	backfillCmd.Flags().StringVar(&backfillFlags.ProgressFile, "progress-file", backfillFlags.ProgressFile, "Record restarted workloads in this file and skip them when run again")
+	addHandlerFlags(backfillCmd, &backfillHandler)
+}
@@ -0,0 +1,182 @@
+// Package cmd ...
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal/admission"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// explainOptions are the flags of explain command
+type explainOptions struct {
+	filename             string
+	namespace            string
+	namespaceAnnotations map[string]string
+}
+
+var (
+	explainHandler = admission.NewRequestsHandler()
+	explainFlags   = explainOptions{namespace: "default", namespaceAnnotations: map[string]string{}}
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain [pod/NAME | NAME] [-f FILE]",
+	Short: "Show the injection decision of webhook for a pod or manifest",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		explanation, err := runExplain(cmd.Context(), cmd, args)
+		if err != nil {
+			return err
+		}
+		return printExplanation(os.Stdout, explanation)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().StringVarP(&explainFlags.filename, "filename", "f", explainFlags.filename, "Manifest of a pod, deployment or statefulset to explain, - for standard input")
+	explainCmd.Flags().StringVarP(&explainFlags.namespace, "namespace", "n", explainFlags.namespace, "Namespace of the pod, the namespace of manifest if not specified")
+	explainCmd.Flags().StringToStringVar(&explainFlags.namespaceAnnotations, "namespace-annotations", explainFlags.namespaceAnnotations, "Annotations of the namespace instead of reading them from cluster, e.g. timezone.jugglechat.io/timezone=Asia/Tokyo")
+	addHandlerFlags(explainCmd, &explainHandler)
+}
+
+// runExplain explain the pod of args from cluster or the manifest of filename
+func runExplain(ctx context.Context, cmd *cobra.Command, args []string) (*admission.Explanation, error) {
+	var (
+		err                  error
+		object               interface{}
+		namespaceAnnotations map[string]string // nil means read from cluster
+	)
+	if cmd.Flags().Changed("namespace-annotations") {
+		explainHandler.InjectNamespaceAnnotation = true
+		namespaceAnnotations = explainFlags.namespaceAnnotations
+	}
+
+	switch {
+	case explainFlags.filename != "" && len(args) > 0:
+		return nil, errors.New("specify either a pod name or a manifest file, not both")
+	case explainFlags.filename != "":
+		if object, err = readExplainManifest(explainFlags.filename); err != nil {
+			return nil, err
+		}
+		// namespace of manifest is used unless it is set explicitly
+		if accessor, ok := object.(metav1.Object); ok && accessor.GetNamespace() != "" && !cmd.Flags().Changed("namespace") {
+			explainFlags.namespace = accessor.GetNamespace()
+		}
+		if namespaceAnnotations == nil && explainHandler.InjectNamespaceAnnotation {
+			if err = explainHandler.InitializeClientSet(kubeConfigFile); err != nil {
+				return nil, err
+			}
+		}
+	case len(args) == 1:
+		if err = explainHandler.InitializeClientSet(kubeConfigFile); err != nil {
+			return nil, err
+		}
+		if object, err = explainHandler.GetPod(ctx, explainFlags.namespace, strings.TrimPrefix(args[0], "pod/")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("you must specify a pod name or a manifest file")
+	}
+
+	return explainHandler.Explain(ctx, explainFlags.namespace, object, namespaceAnnotations)
+}
+
+// readExplainManifest read an injectable object from file
+func readExplainManifest(filename string) (interface{}, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if filename == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s, error: %w", filename, err)
+	}
+
+	object, err := inject.DecodeObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s, error: %w", filename, err)
+	} else if object == nil {
+		return nil, fmt.Errorf("manifest %s is not a pod, deployment or statefulset", filename)
+	}
+	return object, nil
+}
+
+// printExplanation write explanation as human readable text
+func printExplanation(out io.Writer, explanation *admission.Explanation) error {
+	fmt.Fprintf(out, "Object:   %s %s/%s\n", explanation.Kind, explanation.Namespace, explanation.Name)
+	if explanation.NamespaceAnnotations != nil {
+		keys := make([]string, 0, len(explanation.NamespaceAnnotations))
+		for k := range explanation.NamespaceAnnotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		rows := make([][]string, 0, len(keys))
+		for _, k := range keys {
+			rows = append(rows, []string{k, explanation.NamespaceAnnotations[k]})
+		}
+		fmt.Fprintln(out, "Namespace annotations:")
+		if err := printTable(out, []string{"ANNOTATION", "VALUE"}, rows); err != nil {
+			return err
+		}
+	}
+
+	rows := make([][]string, 0, len(explanation.Decision.Rules))
+	for _, rule := range explanation.Decision.Rules {
+		value := rule.Value
+		if value == "" {
+			value = "-"
+		}
+		rows = append(rows, []string{rule.Name, string(rule.Source), value})
+	}
+	fmt.Fprintln(out, "Rules:")
+	if err := printTable(out, []string{"ANNOTATION", "SOURCE", "VALUE"}, rows); err != nil {
+		return err
+	}
+
+	if explanation.Decision.Generator == nil {
+		fmt.Fprintf(out, "Decision: skip, %s\n", explanation.Decision.Reason)
+	} else {
+		fmt.Fprintf(out, "Decision: inject %s with %s strategy\n", explanation.Decision.Generator.Timezone, explanation.Decision.Generator.Strategy)
+	}
+	for _, warning := range explanation.Warnings {
+		fmt.Fprintf(out, "Warning:  %s\n", warning)
+	}
+
+	if len(explanation.Patches) == 0 {
+		return nil
+	}
+	patches, err := json.MarshalIndent(explanation.Patches, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Patches:\n%s\n", patches)
+	return err
+}
+
+// printTable write rows as an indented table with header
+func printTable(out io.Writer, header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "  %s\n", strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintf(w, "  %s\n", strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,35 @@
+// Package cmd ...
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/m198799/timezone-webhook/internal/admission"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// addHandlerFlags register the webhook defaults consulted by commands which decide like the webhook,
+// they should be the same as the flags of the deployed webhook. Generator settings and handled namespaces
+// are initialized before run
+func addHandlerFlags(cmd *cobra.Command, handler *admission.RequestsHandler) {
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		handler.InitWebHookNamespace()
+		return handler.InitGenerator()
+	}
+
+	cmd.Flags().StringVarP(&handler.DefaultTimezone, "timezone", "t", handler.DefaultTimezone, "Default timezone of webhook")
+	cmd.Flags().StringVarP((*string)(&handler.DefaultInjectionStrategy), "injection-strategy", "s", string(handler.DefaultInjectionStrategy), "Default injection strategy of webhook (hostPath/configmap)")
+	cmd.Flags().BoolVar(&handler.InjectByDefault, "inject", handler.InjectByDefault, "Whether injection is enabled by default in webhook")
+	cmd.Flags().StringVar(&handler.ConfigMapName, "configmap", handler.ConfigMapName, "Configmap name of webhook")
+	cmd.Flags().StringSliceVar(&handler.EnvTemplateNames, "env-templates", handler.EnvTemplateNames, "Env templates injected by webhook besides TZ, e.g. java,locale")
+	cmd.Flags().StringVar(&handler.EnvTemplatesFile, "env-templates-file", handler.EnvTemplatesFile, "File of env templates added to the built-in ones")
+	cmd.Flags().StringToStringVar(&handler.MountLayouts, "mount-layout", handler.MountLayouts, "Mount layout of webhook per strategy, e.g. configmap=directory")
+	cmd.Flags().StringToStringVar(&handler.RegionTimezones, "region-timezones", handler.RegionTimezones, "Region or zone to timezone map of webhook, e.g. us-east-1=America/New_York")
+	cmd.Flags().StringVar(&handler.TimezoneSchedulesFile, "timezone-schedules-file", handler.TimezoneSchedulesFile, "File of scheduled default timezones of webhook")
+	cmd.Flags().StringArrayVar(&handler.LabelTimezones, "label-timezone", handler.LabelTimezones, "Label timezone rules of webhook as <selector>=<timezone>")
+	cmd.Flags().BoolVar(&handler.ResolveOwners, "resolve-owners", handler.ResolveOwners, "Whether webhook inherits annotations of pod owners")
+	cmd.Flags().StringVar(&handler.HostPathNodeLabel, "hostpath-node-label", handler.HostPathNodeLabel, "Node label declaring tzdata of webhook")
+	cmd.Flags().BoolVar(&handler.NodeLabelStrategy, "node-label-strategy", handler.NodeLabelStrategy, "Whether webhook chooses strategy at admission from labels of eligible nodes")
+	cmd.Flags().StringVar(&handler.ZoneInfoNamespaces, "namespaces", handler.ZoneInfoNamespaces, "Namespaces handled by webhook, comma separated, "+inject.DefaultNamespace+" if empty")
+	cmd.Flags().BoolVar(&handler.InjectNamespaceAnnotation, "injectNamespaceAnnotation", handler.InjectNamespaceAnnotation, "Whether namespace annotations are enabled in webhook")
+}
@@ -2,7 +2,6 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 	"os"
 
@@ -11,28 +10,41 @@ import (
 	"github.com/m198799/timezone-webhook/internal/inject"
 )
 
-var patchGenerator = inject.NewPatchGenerator()
+var (
+	// injectGenerator honor the same annotations and defaults as the webhook
+	injectGenerator = inject.AnnotatedGenerator{PatchGenerator: inject.NewPatchGenerator(), InjectByDefault: true}
+	patchGenerator  = &injectGenerator.PatchGenerator
+	krmFunction     bool
+	postRenderer    bool
+	// envTemplatesFile is added to the built-in env templates
+	envTemplatesFile string
+	// mountLayouts is the mount layout per strategy
+	mountLayouts = map[string]string{}
+	// labelTimezones are the label timezone rules
+	labelTimezones []string
+)
 
 var injectCmd = &cobra.Command{
 	Use:   "inject",
 	Short: "inject timezone and system out yaml",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 0 {
-			return errors.New("you must specify at least one input")
+		var err error
+		if injectGenerator.EnvTemplates, err = inject.LoadEnvTemplates(envTemplatesFile); err != nil {
+			return err
 		}
-
-		inputs, err := inject.ArgumentsToInputs(args)
-		if err != nil {
-			return fmt.Errorf("failed to open inputs from arguments: %w", err)
+		if patchGenerator.MountLayouts, err = inject.ParseMountLayouts(mountLayouts); err != nil {
+			return err
 		}
-
-		transformer := &inject.Transformer{
-			PatchGenerator: patchGenerator,
-			Inputs:         inputs,
-			Output:         os.Stdout,
+		if injectGenerator.LabelTimezones, err = inject.ParseLabelTimezones(labelTimezones); err != nil {
+			return err
 		}
 
-		return transformer.Transform()
+		if krmFunction {
+			return inject.RunKRMFunction(cmd.Context(), os.Stdin, os.Stdout, injectGenerator)
+		} else if postRenderer {
+			return runPostRenderer(args)
+		}
+		return runTransform(&injectGenerator, args)
 	},
 }
 
@@ -43,4 +55,26 @@ func init() {
 	injectCmd.Flags().StringVarP((*string)(&patchGenerator.Strategy), "strategy", "s", string(patchGenerator.Strategy), "Default injection strategy if not specified explicitly (hostPath/initContainer)")
 	injectCmd.Flags().StringVar(&patchGenerator.HostPathPrefix, "hostpath", patchGenerator.HostPathPrefix, "Location of TZif files on host machines")
 	injectCmd.Flags().StringVarP(&patchGenerator.LocalTimePath, "mountpath", "m", patchGenerator.LocalTimePath, "Mount path for TZif file on containers")
+	injectCmd.Flags().BoolVar(&injectGenerator.InjectByDefault, "inject", injectGenerator.InjectByDefault, "Whether injection is enabled by default or should be requested by annotation")
+	injectCmd.Flags().StringVar(&patchGenerator.TimezoneFilePath, "timezone-file-path", patchGenerator.TimezoneFilePath, "Mount a file containing the zone name at this path, e.g. /etc/timezone, disabled if empty")
+	injectCmd.Flags().StringVar(&patchGenerator.ZoneInfoPath, "zoneinfo-path", patchGenerator.ZoneInfoPath, "Mount the zoneinfo tree at this path, e.g. /usr/share/zoneinfo, configmap strategy mount only the injected zones into the tree of image, disabled for configmap strategy if empty")
+	injectCmd.Flags().StringToStringVar(&mountLayouts, "mount-layout", mountLayouts, "Mount layout per strategy (subpath/directory), e.g. configmap=directory")
+	injectCmd.Flags().StringVar(&patchGenerator.ZoneInfoMountDir, "zoneinfo-mount-dir", patchGenerator.ZoneInfoMountDir, "Where configmap is mounted by directory layout, "+inject.DefaultZoneInfoMountDir+" if empty")
+	injectCmd.Flags().StringVar(&patchGenerator.HostPathLayout, "hostpath-layout", patchGenerator.HostPathLayout, "Node path of TZif files with {zone} and {name} placeholders for hostPath strategy, e.g. /opt/tzdata/{name}")
+	injectCmd.Flags().StringVar(&patchGenerator.HostPathNodeLabel, "hostpath-node-label", patchGenerator.HostPathNodeLabel, "Only schedule pods of hostPath strategy to nodes with this label declaring tzdata, e.g. timezone.jugglechat.io/tzdata=true")
+	injectCmd.Flags().StringArrayVar(&labelTimezones, "label-timezone", labelTimezones, "Timezone of pods matching a label selector as <selector>=<timezone>, the first matching rule wins, e.g. app.kubernetes.io/part-of=billing=America/New_York")
+	injectCmd.Flags().StringToStringVar(&injectGenerator.RegionTimezones, "region-timezones", injectGenerator.RegionTimezones, "Map topology region or zone to timezone for pods pinned to it, e.g. us-east-1=America/New_York")
+	injectCmd.Flags().StringSliceVar(&injectGenerator.EnvTemplateNames, "env-templates", injectGenerator.EnvTemplateNames, "Env templates injected besides TZ if not specified explicitly, e.g. java,locale")
+	injectCmd.Flags().StringVar(&envTemplatesFile, "env-templates-file", envTemplatesFile, "File of env templates added to the built-in ones (java, locale)")
+	injectCmd.Flags().BoolVar(&krmFunction, "krm", krmFunction, "Run as a KRM function, read a ResourceList from standard input and write it to standard output")
+	injectCmd.Flags().BoolVar(&postRenderer, "post-renderer", postRenderer, "Run as a helm post-renderer, inject manifests from standard input honoring annotations and write them to standard output")
+	addTransformFlags(injectCmd)
+}
+
+// runPostRenderer inject the manifests stream of helm from standard input
+func runPostRenderer(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("post-renderer reads manifests from standard input, unexpected arguments: %v", args)
+	}
+	return inject.RunPostRenderer(os.Stdin, os.Stdout, &injectGenerator)
 }
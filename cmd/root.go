@@ -6,13 +6,21 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/m198799/timezone-webhook/internal"
 	"github.com/m198799/timezone-webhook/internal/log"
 )
 
-var kubeConfigFile = "/Users/m/.kube/config"
+var (
+	kubeConfigFile = "/Users/m/.kube/config"
+	// annotationPrefixes are shared by webhook and commands, the first one is primary
+	annotationPrefixes = []string{internal.DefaultAnnotationPrefix}
+)
 
 var rootCmd = &cobra.Command{
 	Use: "webhook",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return internal.SetAnnotationPrefixes(annotationPrefixes)
+	},
 }
 
 // Execute ...
@@ -27,4 +35,5 @@ func init() {
 	cobra.OnInitialize()
 
 	rootCmd.PersistentFlags().StringVar(&kubeConfigFile, "kube-config", kubeConfigFile, "Path to kubeconfig file")
+	rootCmd.PersistentFlags().StringSliceVar(&annotationPrefixes, "annotation-prefix", annotationPrefixes, "Prefix of annotations, post-injection annotations are written under the first one and the others are still read, e.g. timezone.example.com,timezone.jugglechat.io")
 }
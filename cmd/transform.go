@@ -0,0 +1,64 @@
+// Package cmd ...
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// transformOptions are the flags shared by commands built on inject.Transformer
+type transformOptions struct {
+	outputFormat       string
+	inPlace            bool
+	preserveFormatting bool
+	outputDir          string
+	inputOptions       inject.InputOptions
+}
+
+var transformFlags = transformOptions{
+	preserveFormatting: true,
+}
+
+// addTransformFlags register transformOptions flags on cmd
+func addTransformFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&transformFlags.outputFormat, "output", "o", transformFlags.outputFormat, "Output format (yaml/json/patch/strategic-merge), the same as input if not specified")
+	cmd.Flags().BoolVarP(&transformFlags.inPlace, "in-place", "i", transformFlags.inPlace, "Rewrite input files instead of writing to standard output")
+	cmd.Flags().BoolVar(&transformFlags.preserveFormatting, "preserve-formatting", transformFlags.preserveFormatting, "Keep comments, key order and formatting of yaml output, only injected nodes are written")
+	cmd.Flags().StringVar(&transformFlags.outputDir, "output-dir", transformFlags.outputDir, "Write every input to this directory keeping the input tree instead of writing to standard output")
+	cmd.Flags().BoolVarP(&transformFlags.inputOptions.Recursive, "recursive", "R", transformFlags.inputOptions.Recursive, "Walk sub directories of directory inputs")
+	cmd.Flags().StringSliceVar(&transformFlags.inputOptions.Include, "include", transformFlags.inputOptions.Include, "Only read files matching these globs in directory and glob inputs")
+	cmd.Flags().StringSliceVar(&transformFlags.inputOptions.Exclude, "exclude", transformFlags.inputOptions.Exclude, "Skip files matching these globs in directory and glob inputs")
+}
+
+// runTransform transform inputs from args with generator
+func runTransform(generator inject.Generator, args []string) error {
+	if len(args) == 0 {
+		return errors.New("you must specify at least one input")
+	}
+
+	inputs, err := inject.CollectInputs(args, transformFlags.inputOptions)
+	if err != nil {
+		return fmt.Errorf("failed to open inputs from arguments: %w", err)
+	}
+
+	transformer := &inject.Transformer{
+		Generator: generator,
+		Inputs:    inputs,
+		Output:    os.Stdout,
+		Format:    inject.OutputFormat(transformFlags.outputFormat),
+		InPlace:   transformFlags.inPlace,
+		OutputDir: transformFlags.outputDir,
+
+		PreserveFormatting: transformFlags.preserveFormatting,
+	}
+	if len(inputs) > 1 || transformFlags.inPlace || transformFlags.outputDir != "" {
+		transformer.Report = os.Stderr
+	}
+
+	return transformer.Transform()
+}
@@ -0,0 +1,25 @@
+// Package cmd ...
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+var uninjector = inject.Uninjector{}
+
+var uninjectCmd = &cobra.Command{
+	Use:   "uninject",
+	Short: "remove injected timezone and system out yaml",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTransform(&uninjector, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uninjectCmd)
+
+	uninjectCmd.Flags().StringVar(&uninjector.HostPathNodeLabel, "hostpath-node-label", uninjector.HostPathNodeLabel, "Node label added to node selector by hostPath strategy, e.g. timezone.jugglechat.io/tzdata=true")
+	addTransformFlags(uninjectCmd)
+}
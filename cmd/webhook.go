@@ -5,6 +5,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/m198799/timezone-webhook/internal/admission"
+	"github.com/m198799/timezone-webhook/internal/inject"
 )
 
 var webhook = admission.NewAdmissionServer()
@@ -38,5 +39,20 @@ func init() {
 	webhookCmd.Flags().BoolVar(&webhook.Verbose, "verbose", webhook.Verbose, "Print more verbose logs for debugging")
 	webhookCmd.Flags().StringVar(&webhook.Handler.ConfigMapName, "configmap", webhook.Handler.ConfigMapName, "When configmap inject timezone,this is configmap name")
 	webhookCmd.Flags().StringVar(&webhook.Handler.ZoneInfoNamespaces, "namespaces", webhook.Handler.ZoneInfoNamespaces, "Handler TimeZone Namespace")
+	webhookCmd.Flags().StringVar((*string)(&webhook.Handler.DefaultErrorPolicy), "error-policy", string(webhook.Handler.DefaultErrorPolicy), "How to answer when injection failed (reject/allow-unpatched/allow-with-warning) for every error class, if not set reject except the namespace class which is allow-with-warning as it never rejected before")
+	webhookCmd.Flags().StringToStringVar(&webhook.Handler.ErrorPolicyOverrides, "error-policy-class", webhook.Handler.ErrorPolicyOverrides, "Error policy per error class, e.g. namespace=allow-with-warning,generate=reject (classes: decode/namespace/owner/node/generate/internal)")
+	webhookCmd.Flags().StringSliceVar(&webhook.Handler.EnvTemplateNames, "env-templates", webhook.Handler.EnvTemplateNames, "Env templates injected besides TZ if not specified explicitly, e.g. java,locale")
+	webhookCmd.Flags().StringVar(&webhook.Handler.EnvTemplatesFile, "env-templates-file", webhook.Handler.EnvTemplatesFile, "File of env templates added to the built-in ones (java, locale)")
+	webhookCmd.Flags().StringVar(&webhook.Handler.TimezoneFilePath, "timezone-file-path", webhook.Handler.TimezoneFilePath, "Mount a file containing the zone name at this path, e.g. /etc/timezone, disabled if empty")
+	webhookCmd.Flags().StringVar(&webhook.Handler.ZoneInfoPath, "zoneinfo-path", webhook.Handler.ZoneInfoPath, "Mount the zoneinfo tree at this path, e.g. /usr/share/zoneinfo, configmap strategy mount only the injected zones into the tree of image, disabled for configmap strategy if empty")
+	webhookCmd.Flags().StringToStringVar(&webhook.Handler.MountLayouts, "mount-layout", webhook.Handler.MountLayouts, "Mount layout per strategy (subpath/directory), directory layout let tzdata updates reach running pods, e.g. configmap=directory")
+	webhookCmd.Flags().StringVar(&webhook.Handler.ZoneInfoMountDir, "zoneinfo-mount-dir", webhook.Handler.ZoneInfoMountDir, "Where configmap is mounted by directory layout, "+inject.DefaultZoneInfoMountDir+" if empty")
+	webhookCmd.Flags().StringVar(&webhook.Handler.HostPathLayout, "hostpath-layout", webhook.Handler.HostPathLayout, "Node path of TZif files with {zone} and {name} placeholders for hostPath strategy, e.g. /opt/tzdata/{name}, hostPathPrefix/{zone} if empty")
+	webhookCmd.Flags().StringVar(&webhook.Handler.HostPathNodeLabel, "hostpath-node-label", webhook.Handler.HostPathNodeLabel, "Only schedule pods of hostPath strategy to nodes with this label declaring tzdata, e.g. timezone.jugglechat.io/tzdata=true")
+	webhookCmd.Flags().StringToStringVar(&webhook.Handler.RegionTimezones, "region-timezones", webhook.Handler.RegionTimezones, "Map topology region or zone to timezone, pods pinned to a region and namespaces annotated with a region take its timezone, e.g. us-east-1=America/New_York")
+	webhookCmd.Flags().StringVar(&webhook.Handler.TimezoneSchedulesFile, "timezone-schedules-file", webhook.Handler.TimezoneSchedulesFile, "File of scheduled default timezones with effectiveFrom and optional namespace rollout order, for migrating to a new timezone at a defined moment")
+	webhookCmd.Flags().StringArrayVar(&webhook.Handler.LabelTimezones, "label-timezone", webhook.Handler.LabelTimezones, "Timezone of pods matching a label selector as <selector>=<timezone>, the first matching rule wins, e.g. app.kubernetes.io/part-of=billing=America/New_York")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.ResolveOwners, "resolve-owners", webhook.Handler.ResolveOwners, "Inherit annotations of pod owners, e.g. ReplicaSet->Deployment and Job->CronJob, from cached listers")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.NodeLabelStrategy, "node-label-strategy", webhook.Handler.NodeLabelStrategy, "Choose strategy at admission from node labels: hostPath when every node a pod is eligible for has hostpath-node-label, else configmap, unless strategy is set by annotation. The node pod is scheduled to is not checked")
 	webhookCmd.Flags().BoolVar(&webhook.Handler.InjectNamespaceAnnotation, "injectNamespaceAnnotation", webhook.Handler.InjectNamespaceAnnotation, "Whether namespace annotations are enabled for injection")
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	admission "k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
@@ -21,7 +22,6 @@ import (
 
 const (
 	jsonContentType = "application/json"
-	injectFalse     = "false"
 )
 
 var (
@@ -54,133 +54,138 @@ func (h *RequestsHandler) readAdmissionReview(r *http.Request) (*admission.Admis
 	return review, http.StatusOK, nil
 }
 
-// handleAdmissionReview is handler admission
-func (h *RequestsHandler) handleAdmissionReview(ctx context.Context, review *admission.AdmissionReview) (internal.Patches, error) {
+// handleAdmissionReview is handler admission, return patches and warnings for user
+func (h *RequestsHandler) handleAdmissionReview(ctx context.Context, review *admission.AdmissionReview) (internal.Patches, []string, error) {
 	log.Info(fmt.Sprintf("handleAdmissionReview request is %s namespace %s", review.Request.Kind.String(), review.Request.Namespace))
 
-	if review.Request.Operation == admission.Create &&
-		review.Request.Namespace != metav1.NamespaceSystem &&
-		review.Request.Namespace != metav1.NamespacePublic &&
-		!h.IsFilterNamespace(review.Request.Namespace) {
-		return h.handlePodAdmissionRequest(ctx, review.Request)
+	if !h.handledNamespace(review.Request.Namespace) {
+		return nil, nil, nil
 	}
-	return nil, nil
+
+	switch review.Request.Kind.Kind {
+	case deploymentKind, statefulSetKind:
+		if review.Request.Operation == admission.Create || review.Request.Operation == admission.Update {
+			return h.handleWorkloadAdmissionRequest(ctx, review.Request)
+		}
+	case podKind:
+		if review.Request.Operation == admission.Create {
+			return h.handlePodAdmissionRequest(ctx, review.Request)
+		}
+	}
+	return nil, nil, nil
+}
+
+// handledNamespace report whether objects in namespace are handled by webhook, kube-system, kube-public
+// and namespaces not in ZoneInfoNamespaces are never handled
+func (h *RequestsHandler) handledNamespace(namespace string) bool {
+	return namespace != metav1.NamespaceSystem && namespace != metav1.NamespacePublic && !h.IsFilterNamespace(namespace)
 }
 
 // handlePodAdmissionRequest handler pods create reqeust
-func (h *RequestsHandler) handlePodAdmissionRequest(ctx context.Context, req *admission.AdmissionRequest) (internal.Patches, error) {
+func (h *RequestsHandler) handlePodAdmissionRequest(ctx context.Context, req *admission.AdmissionRequest) (internal.Patches, []string, error) {
 	raw := req.Object.Raw
 	pod := corev1.Pod{}
 	if _, _, err := k8sDecode.Decode(raw, nil, &pod); err != nil {
 		log.Error("could not deserialize pod object", "err", err)
-		return nil, fmt.Errorf("could not deserialize pod object: %v", err)
+		return nil, nil, newClassifiedError(DecodeErrorClass, fmt.Errorf("could not deserialize pod object: %v", err))
 	}
 	var (
 		err       error
 		patches   internal.Patches       // patches object record patch field
+		warnings  []string               // warnings is returned to user by api-server
 		generator *inject.PatchGenerator // generator is generator patches
 	)
 
-	if generator, err = h.lookupPod(ctx, req.Namespace, &pod); err != nil {
-		return nil, fmt.Errorf("failed to lookup generator, error: %w", err)
+	if generator, warnings, err = h.lookupPod(ctx, req.Namespace, &pod); err != nil {
+		return nil, warnings, fmt.Errorf("failed to lookup generator, error: %w", err)
 	} else if generator == nil {
-		return patches, nil
+		return patches, warnings, nil
 	}
 
 	if patches, err = generator.Generate(ctx, &pod, ""); err != nil {
-		return nil, fmt.Errorf("failed to generate patches for pod, error: %w", err)
+		return nil, warnings, newClassifiedError(GenerateErrorClass, fmt.Errorf("failed to generate patches for pod, error: %w", err))
 	}
-	return patches, err
+	return patches, warnings, err
 }
 
-// lookupPod is from pod or namespace read Annotations()
-func (h *RequestsHandler) lookupPod(ctx context.Context, namespace string, pod *corev1.Pod) (*inject.PatchGenerator, error) {
+// lookupPod is from pod or namespace read Annotations(), return nil generator if pod should not be injected
+func (h *RequestsHandler) lookupPod(ctx context.Context, namespace string, pod *corev1.Pod) (*inject.PatchGenerator, []string, error) {
 	var (
-		err      error
-		ok       bool                     // check key whether in the map
-		isInject string                   // user set annotation internal.InjectAnnotation value
-		timezone string                   // user set annotation value
-		strategy inject.InjectionStrategy // user set annotation value
-		tmpV     string
-		// user set annotation value in namespace
-		strategyNamespace inject.InjectionStrategy
-		timezoneNamespace string
-		injectNamespace   bool
+		err                  error
+		namespaceAnnotations map[string]string // user set annotations in namespace
+		annotations          map[string]string // pod annotations with the ones inherited from owners
+		decision             inject.Decision   // decision of shared engine
 	)
 	if h.InjectNamespaceAnnotation {
-		injectNamespace, strategyNamespace, timezoneNamespace, err = h.injectNamespace(ctx, namespace)
-		if err != nil && injectNamespace {
-			return nil, err
+		if namespaceAnnotations, err = h.namespaceAnnotations(ctx, namespace); err != nil {
+			return nil, nil, err
 		}
 	}
+	if annotations, err = h.podAnnotations(ctx, namespace, pod); err != nil {
+		return nil, nil, err
+	}
 
-	if _, ok = pod.Annotations[internal.InjectedAnnotation]; ok {
-		log.Info(fmt.Sprintf("skipping pod (%s/%s) because its already injected", namespace, pod.Name))
-		return nil, nil
+	if decision = h.annotatedGenerator(namespace).Decide(annotations, namespaceAnnotations, pod.Labels, &pod.Spec); decision.Generator == nil {
+		log.Info(fmt.Sprintf("skipping pod (%s/%s) because %s", namespace, pod.Name, decision.Reason))
+		return nil, decision.Warnings, nil
+	}
+	if err = h.selectNodeLabelStrategy(ctx, pod, &decision); err != nil {
+		return nil, decision.Warnings, err
 	}
+	warnings := append(decision.Warnings, containerTZWarnings(pod, decision.Generator)...)
 
-	// first from pod read,second from namespace read,three from default value
-	if isInject, ok = pod.Annotations[internal.InjectAnnotation]; ok {
-		if isInject == injectFalse {
-			log.Info(fmt.Sprintf("skipping pod (%s/%s) because annotation on pod is explicitly false for injection", namespace, pod.Name))
-			return nil, nil
-		}
-	} else if !h.InjectByDefault {
-		log.Info(fmt.Sprintf("skipping pod (%s/%s) because no other instruction and injection disabled by default", namespace, pod.Name))
-		return nil, nil
-	}
-
-	timezone = h.DefaultTimezone
-	if tmpV, ok = pod.Annotations[internal.TimezoneAnnotation]; ok {
-		log.Info(fmt.Sprintf("explicit timezone requested on pod's (%s/%s) annotation: %s", namespace, pod.Name, timezone))
-		timezone = tmpV
-	} else if timezoneNamespace != "" {
-		log.Info(fmt.Sprintf("explicit timezone requested on namespace (%s/%s) annotation: %s", namespace, pod.Name, timezone))
-		timezone = timezoneNamespace
-	}
-
-	strategy = h.DefaultInjectionStrategy
-	if tmpV, ok = pod.Annotations[internal.InjectionStrategyAnnotation]; ok {
-		strategy = inject.InjectionStrategy(tmpV)
-		log.Info(fmt.Sprintf("explicit injection strategy requested on pod's (%s/%s) annotation: %s", namespace, pod.Name, tmpV))
-	} else if strategyNamespace != "" {
-		strategy = strategyNamespace
-		log.Info(fmt.Sprintf("explicit injection strategy requested on namespace (%s/%s) annotation: %s", namespace, pod.Name, tmpV))
-	}
-	log.Info(fmt.Sprintf("inject.PatchGenerator Strategy is %s,Timezone is %s,ConfigMapName is %s", strategy, timezone, h.ConfigMapName))
-	return &inject.PatchGenerator{
-		Strategy:       strategy,
-		Timezone:       timezone,
-		HostPathPrefix: h.HostPathPrefix,
-		LocalTimePath:  h.LocalTimePath,
-		ConfigMapName:  h.ConfigMapName,
-	}, nil
+	log.Info(fmt.Sprintf("inject.PatchGenerator Strategy is %s,Timezone is %s,ConfigMapName is %s", decision.Generator.Strategy, decision.Generator.Timezone, decision.Generator.ConfigMapName))
+	return decision.Generator, warnings, nil
 }
 
-func (h *RequestsHandler) injectNamespace(ctx context.Context, namespace string) (bool, inject.InjectionStrategy, string, error) {
-	var (
-		err          error
-		namespaceObj *corev1.Namespace        // read namespace object
-		strategy     inject.InjectionStrategy // namespace injection Strategy
-		ok           bool                     // check key whether in the map
-		isInject     string                   // user set annotation internal.InjectAnnotation value
-		timezone     string
-		tmpV         string
-	)
-	if namespaceObj, err = h.clientSet.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{}); err != nil {
-		log.Error("failed to lookup namespace", namespace, "err", err)
-		return false, "", "", fmt.Errorf("failed to lookup namespace %s: %v", namespace, err)
-	}
-	if tmpV, ok = namespaceObj.Annotations[internal.InjectionStrategyAnnotation]; ok {
-		strategy = inject.InjectionStrategy(tmpV)
-	}
+// annotatedGenerator return the decision engine with defaults of handler, the default timezone is
+// replaced by the timezone schedule effective in namespace now
+func (h *RequestsHandler) annotatedGenerator(namespace string) *inject.AnnotatedGenerator {
+	generator := &inject.AnnotatedGenerator{
+		PatchGenerator: inject.PatchGenerator{
+			Strategy:       h.DefaultInjectionStrategy,
+			Timezone:       h.DefaultTimezone,
+			HostPathPrefix: h.HostPathPrefix,
+			LocalTimePath:  h.LocalTimePath,
+			ConfigMapName:  h.ConfigMapName,
+
+			TimezoneFilePath: h.TimezoneFilePath,
+			ZoneInfoPath:     h.ZoneInfoPath,
+			MountLayouts:     h.mountLayouts,
+			ZoneInfoMountDir: h.ZoneInfoMountDir,
+
+			HostPathLayout:    h.HostPathLayout,
+			HostPathNodeLabel: h.HostPathNodeLabel,
+		},
+		InjectByDefault:  h.InjectByDefault,
+		EnvTemplateNames: h.EnvTemplateNames,
+		EnvTemplates:     h.envTemplates,
+		RegionTimezones:  h.RegionTimezones,
+		LabelTimezones:   h.labelTimezones,
+	}
+	if schedule := activeSchedule(h.timezoneSchedules, namespace, time.Now()); schedule != nil {
+		log.Debug(fmt.Sprintf("timezone schedule effective from %s is active in namespace %s, default timezone is %s", schedule.EffectiveFrom.Format(time.RFC3339), namespace, schedule.Timezone))
+		generator.Timezone = schedule.Timezone
+	}
+	return generator
+}
 
-	if tmpV, ok = namespaceObj.Annotations[internal.TimezoneAnnotation]; ok {
-		timezone = tmpV
+// podAnnotations return annotations of pod, annotations of its owners are inherited when ResolveOwners is set,
+// the precedence is pod, then the nearest owner, e.g. pod > ReplicaSet > Deployment
+func (h *RequestsHandler) podAnnotations(ctx context.Context, namespace string, pod *corev1.Pod) (map[string]string, error) {
+	inherited, err := h.ownerAnnotations(ctx, namespace, pod.OwnerReferences)
+	if err != nil || len(inherited) == 0 {
+		return pod.Annotations, err
 	}
-	if isInject, ok = namespaceObj.Annotations[internal.InjectAnnotation]; ok && isInject == injectFalse {
-		log.Info(fmt.Sprintf("skipping namespace %s because annotation on namespace is explicitly false for injection", namespace))
-		return false, strategy, timezone, nil
+	return inject.MergeAnnotations(inherited, pod.Annotations), nil
+}
+
+// namespaceAnnotations read annotations of namespace
+func (h *RequestsHandler) namespaceAnnotations(ctx context.Context, namespace string) (map[string]string, error) {
+	namespaceObj, err := h.clientSet.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		log.Error("failed to lookup namespace", namespace, "err", err)
+		return nil, newClassifiedError(NamespaceErrorClass, fmt.Errorf("failed to lookup namespace %s: %v", namespace, err))
 	}
-	return true, strategy, timezone, nil
+	return namespaceObj.Annotations, nil
 }
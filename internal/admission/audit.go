@@ -0,0 +1,166 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// AuditEntry is the timezone coverage of a pod or workload
+type AuditEntry struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	// Injected is true when the object has InjectedAnnotation
+	Injected bool   `json:"injected"`
+	Timezone string `json:"timezone,omitempty"`
+	Strategy string `json:"strategy,omitempty"`
+	// ManualTZ is the TZ env set by user on containers of an object which is not injected
+	ManualTZ string `json:"manualTZ,omitempty"`
+	// MissingConfigMap is true when configmap strategy is used but zoneinfo configmap does not exist
+	MissingConfigMap bool `json:"missingConfigMap"`
+	// InjectOnRestart is true when the webhook would inject it on next restart or rollout
+	InjectOnRestart bool   `json:"injectOnRestart"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// auditNamespace is the namespace state shared by entries of the namespace
+type auditNamespace struct {
+	name          string
+	annotations   map[string]string
+	hasConfigMap  bool
+	notHandledWhy string
+}
+
+// Audit report timezone coverage of pods, deployments and statefulsets in namespaces,
+// all namespaces are audited when namespaces is empty. It never writes to the cluster
+func (h *RequestsHandler) Audit(ctx context.Context, namespaces []string) ([]AuditEntry, error) {
+	if len(namespaces) == 0 {
+		list, err := h.clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list namespaces, error: %w", err)
+		}
+		for _, ns := range list.Items {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+
+	var entries []AuditEntry
+	for _, namespace := range namespaces {
+		ns, err := h.auditNamespace(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		namespaceEntries, err := h.auditObjects(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, namespaceEntries...)
+	}
+	return entries, nil
+}
+
+// auditNamespace read annotations and zoneinfo configmap of namespace
+func (h *RequestsHandler) auditNamespace(ctx context.Context, namespace string) (*auditNamespace, error) {
+	ns := &auditNamespace{name: namespace}
+	if !h.handledNamespace(namespace) {
+		ns.notHandledWhy = "namespace is not handled by webhook"
+	}
+
+	if h.InjectNamespaceAnnotation {
+		annotations, err := h.namespaceAnnotations(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		ns.annotations = annotations
+	}
+
+	_, err := h.clientSet.CoreV1().ConfigMaps(namespace).Get(ctx, h.ConfigMapName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get configmap %s/%s, error: %w", namespace, h.ConfigMapName, err)
+	}
+	ns.hasConfigMap = err == nil
+	return ns, nil
+}
+
+// auditObjects list pods and workloads of namespace
+func (h *RequestsHandler) auditObjects(ctx context.Context, ns *auditNamespace) ([]AuditEntry, error) {
+	var entries []AuditEntry
+
+	pods, err := h.clientSet.CoreV1().Pods(ns.name).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in namespace %s, error: %w", ns.name, err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		entries = append(entries, h.auditPod(ns, podKind, pod.Name, pod, pod.Annotations))
+	}
+
+	deployments, err := h.clientSet.AppsV1().Deployments(ns.name).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments in namespace %s, error: %w", ns.name, err)
+	}
+	for i := range deployments.Items {
+		entries = append(entries, h.auditWorkload(ns, deploymentKind, &deployments.Items[i].ObjectMeta, &deployments.Items[i].Spec.Template))
+	}
+
+	statefulSets, err := h.clientSet.AppsV1().StatefulSets(ns.name).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace %s, error: %w", ns.name, err)
+	}
+	for i := range statefulSets.Items {
+		entries = append(entries, h.auditWorkload(ns, statefulSetKind, &statefulSets.Items[i].ObjectMeta, &statefulSets.Items[i].Spec.Template))
+	}
+
+	return entries, nil
+}
+
+// auditWorkload audit the pod template of a workload, template annotations record the injection
+func (h *RequestsHandler) auditWorkload(ns *auditNamespace, kind string, meta *metav1.ObjectMeta, template *corev1.PodTemplateSpec) AuditEntry {
+	return h.auditPod(ns, kind, meta.Name, workloadPod(meta, template), template.Annotations)
+}
+
+// auditPod build the entry of pod, injectedAnnotations are where the post-injection annotations are
+func (h *RequestsHandler) auditPod(ns *auditNamespace, kind, name string, pod *corev1.Pod, injectedAnnotations map[string]string) AuditEntry {
+	entry := AuditEntry{Namespace: ns.name, Kind: kind, Name: name}
+
+	if _, entry.Injected = internal.LookupAnnotation(injectedAnnotations, internal.InjectedAnnotation); entry.Injected {
+		entry.Timezone = inject.InjectedTimezone(injectedAnnotations)
+		entry.Strategy = string(inject.InjectedStrategy(&pod.Spec))
+	} else if ns.notHandledWhy != "" {
+		entry.Reason = ns.notHandledWhy
+	} else {
+		decision := h.annotatedGenerator(ns.name).Decide(pod.Annotations, ns.annotations, pod.Labels, &pod.Spec)
+		if decision.Generator == nil {
+			entry.Reason = decision.Reason
+		} else {
+			entry.InjectOnRestart = true
+			entry.Timezone = decision.Generator.Timezone
+			entry.Strategy = string(decision.Generator.Strategy)
+		}
+	}
+
+	if !entry.Injected {
+		entry.ManualTZ = manualTZ(&pod.Spec)
+	}
+	entry.MissingConfigMap = entry.Strategy == string(inject.ConfigMapInjectionStrategy) && !ns.hasConfigMap
+	return entry
+}
+
+// manualTZ return the first TZ env set on containers
+func manualTZ(spec *corev1.PodSpec) string {
+	for _, c := range spec.Containers {
+		for _, env := range c.Env {
+			if env.Name == inject.TZEnvName {
+				return env.Value
+			}
+		}
+	}
+	return ""
+}
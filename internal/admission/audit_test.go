@@ -0,0 +1,43 @@
+package admission
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestAuditNamespaceGate check pods in namespaces the webhook does not handle are never reported to be injected
+func TestAuditNamespaceGate(t *testing.T) {
+	handler := NewRequestsHandler()
+	handler.ZoneInfoNamespaces = "shop"
+	handler.InitWebHookNamespace()
+
+	var objects []runtime.Object
+	namespaces := []string{"shop", "billing", metav1.NamespaceSystem, metav1.NamespacePublic}
+	for _, namespace := range namespaces {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+		})
+	}
+	handler.clientSet = fake.NewSimpleClientset(objects...)
+
+	entries, err := handler.Audit(context.TODO(), namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(namespaces) {
+		t.Fatalf("expected %d entries, got %+v", len(namespaces), entries)
+	}
+	for _, entry := range entries {
+		if handled := entry.Namespace == "shop"; entry.InjectOnRestart != handled {
+			t.Fatalf("expected inject on restart %v in namespace %s, got %+v", handled, entry.Namespace, entry)
+		} else if !handled && entry.Reason != "namespace is not handled by webhook" {
+			t.Fatalf("expected namespace not handled in %s, got %+v", entry.Namespace, entry)
+		}
+	}
+}
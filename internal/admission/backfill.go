@@ -0,0 +1,292 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+const (
+	// RestartedAtAnnotation is set on pod template to trigger a rollout, the same as kubectl rollout restart
+	RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	// DefaultBackfillInterval is the default wait between two rollouts
+	DefaultBackfillInterval = 10 * time.Second
+	// DefaultBackfillBatchSize is the default number of namespaces in a batch
+	DefaultBackfillBatchSize = 5
+	// DefaultBackfillBatchInterval is the default wait between two namespace batches
+	DefaultBackfillBatchInterval = time.Minute
+)
+
+// BackfillOptions control how backfill rolls out workloads
+type BackfillOptions struct {
+	// Namespaces to backfill, all namespaces if empty
+	Namespaces []string
+	// DryRun only report the workloads which would be restarted
+	DryRun bool
+	// Interval is the wait between two rollouts
+	Interval time.Duration
+	// BatchSize is the number of namespaces in a batch
+	BatchSize int
+	// BatchInterval is the wait between two namespace batches
+	BatchInterval time.Duration
+	// ProgressFile record restarted workloads, they are skipped when backfill is run again
+	ProgressFile string
+}
+
+// NewBackfillOptions ...
+func NewBackfillOptions() BackfillOptions {
+	return BackfillOptions{
+		Interval:      DefaultBackfillInterval,
+		BatchSize:     DefaultBackfillBatchSize,
+		BatchInterval: DefaultBackfillBatchInterval,
+	}
+}
+
+// backfillTarget is a workload with pods which are not injected
+type backfillTarget struct {
+	namespace string
+	kind      string
+	name      string
+}
+
+func (t backfillTarget) String() string {
+	return fmt.Sprintf("%s/%s/%s", t.namespace, t.kind, t.name)
+}
+
+// backfillProgress is the content of progress file
+type backfillProgress struct {
+	Restarted []string `json:"restarted"`
+
+	path string
+	done map[string]bool
+}
+
+// Backfill restart deployments and statefulsets whose pods are not injected but would be injected
+// by the webhook, namespaces not handled by webhook are skipped. Every workload is reported to report
+// as a tab separated line
+func (h *RequestsHandler) Backfill(ctx context.Context, opts BackfillOptions, report io.Writer) error {
+	if opts.BatchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d, it must be positive", opts.BatchSize)
+	}
+	progress, err := loadBackfillProgress(opts.ProgressFile)
+	if err != nil {
+		return err
+	}
+
+	candidates := opts.Namespaces
+	if len(candidates) == 0 {
+		list, err := h.clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list namespaces, error: %w", err)
+		}
+		for _, ns := range list.Items {
+			candidates = append(candidates, ns.Name)
+		}
+	}
+	// workloads in namespaces not handled by webhook would not be injected after restart
+	var namespaces []string
+	for _, namespace := range candidates {
+		if !h.handledNamespace(namespace) {
+			fmt.Fprintf(report, "skipped\t%s\tnamespace is not handled by webhook\n", namespace)
+			continue
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	var restarted int
+	for start := 0; start < len(namespaces); start += opts.BatchSize {
+		if start > 0 && restarted > 0 {
+			if err = sleep(ctx, opts.BatchInterval); err != nil {
+				return err
+			}
+		}
+		restarted = 0
+
+		end := start + opts.BatchSize
+		if end > len(namespaces) {
+			end = len(namespaces)
+		}
+		for _, namespace := range namespaces[start:end] {
+			targets, err := h.backfillTargets(ctx, namespace)
+			if err != nil {
+				return err
+			}
+
+			for _, target := range targets {
+				switch {
+				case progress.done[target.String()]:
+					fmt.Fprintf(report, "skipped\t%s\talready restarted in previous run\n", target)
+					continue
+				case opts.DryRun:
+					fmt.Fprintf(report, "would restart\t%s\n", target)
+					continue
+				}
+
+				if restarted > 0 {
+					if err = sleep(ctx, opts.Interval); err != nil {
+						return err
+					}
+				}
+				if err = h.restartWorkload(ctx, target); err != nil {
+					fmt.Fprintf(report, "failed\t%s\t%v\n", target, err)
+					return err
+				}
+				restarted++
+				fmt.Fprintf(report, "restarted\t%s\n", target)
+				if err = progress.record(target); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// backfillTargets return workloads of namespace which would be injected and have pods not injected
+func (h *RequestsHandler) backfillTargets(ctx context.Context, namespace string) ([]backfillTarget, error) {
+	ns, err := h.auditNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	type workload struct {
+		kind     string
+		meta     *metav1.ObjectMeta
+		template *corev1.PodTemplateSpec
+		selector *metav1.LabelSelector
+	}
+	var workloads []workload
+
+	deployments, err := h.clientSet.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments in namespace %s, error: %w", namespace, err)
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		workloads = append(workloads, workload{deploymentKind, &d.ObjectMeta, &d.Spec.Template, d.Spec.Selector})
+	}
+	statefulSets, err := h.clientSet.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace %s, error: %w", namespace, err)
+	}
+	for i := range statefulSets.Items {
+		s := &statefulSets.Items[i]
+		workloads = append(workloads, workload{statefulSetKind, &s.ObjectMeta, &s.Spec.Template, s.Spec.Selector})
+	}
+
+	var targets []backfillTarget
+	for _, w := range workloads {
+		if entry := h.auditWorkload(ns, w.kind, w.meta, w.template); !entry.InjectOnRestart {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(w.selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of %s %s/%s, error: %w", w.kind, namespace, w.meta.Name, err)
+		}
+		pods, err := h.clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods of %s %s/%s, error: %w", w.kind, namespace, w.meta.Name, err)
+		}
+		for _, pod := range pods.Items {
+			if _, ok := internal.LookupAnnotation(pod.Annotations, internal.InjectedAnnotation); !ok {
+				targets = append(targets, backfillTarget{namespace: namespace, kind: w.kind, name: w.meta.Name})
+				break
+			}
+		}
+	}
+	return targets, nil
+}
+
+// restartWorkload trigger a rollout by setting RestartedAtAnnotation on pod template
+func (h *RequestsHandler) restartWorkload(ctx context.Context, target backfillTarget) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{RestartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	switch target.kind {
+	case deploymentKind:
+		_, err = h.clientSet.AppsV1().Deployments(target.namespace).Patch(ctx, target.name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case statefulSetKind:
+		_, err = h.clientSet.AppsV1().StatefulSets(target.namespace).Patch(ctx, target.name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	default:
+		err = fmt.Errorf("unsupported kind %s", target.kind)
+	}
+	return err
+}
+
+// loadBackfillProgress read progress file, a missing file is an empty progress
+func loadBackfillProgress(path string) (*backfillProgress, error) {
+	progress := &backfillProgress{path: path, done: map[string]bool{}}
+	if path == "" {
+		return progress, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read progress file %s, error: %w", path, err)
+	}
+	if err = json.Unmarshal(data, progress); err != nil {
+		return nil, fmt.Errorf("failed to read progress file %s, error: %w", path, err)
+	}
+	for _, key := range progress.Restarted {
+		progress.done[key] = true
+	}
+	return progress, nil
+}
+
+// record add target to progress and rewrite progress file
+func (p *backfillProgress) record(target backfillTarget) error {
+	p.done[target.String()] = true
+	if p.path == "" {
+		return nil
+	}
+
+	p.Restarted = p.Restarted[:0]
+	for key := range p.done {
+		p.Restarted = append(p.Restarted, key)
+	}
+	sort.Strings(p.Restarted)
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(p.path, data, 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to write progress file %s, error: %w", p.path, err)
+	}
+	return nil
+}
+
+// sleep wait for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestBackfillNamespaceGate check workloads in namespaces the webhook does not handle are never patched,
+// whether namespaces are listed from cluster or given explicitly
+func TestBackfillNamespaceGate(t *testing.T) {
+	handler := NewRequestsHandler()
+	handler.ZoneInfoNamespaces = "shop"
+	handler.InitWebHookNamespace()
+
+	cases := []struct {
+		name       string
+		namespaces []string
+	}{
+		{name: "all namespaces"},
+		{name: "explicit namespaces", namespaces: []string{"shop", "billing", metav1.NamespaceSystem}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, namespace := range []string{"shop", "billing", metav1.NamespaceSystem, metav1.NamespacePublic} {
+				labels := map[string]string{"app": "app"}
+				objects = append(objects,
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+						Spec: appsv1.DeploymentSpec{
+							Selector: &metav1.LabelSelector{MatchLabels: labels},
+							Template: corev1.PodTemplateSpec{
+								ObjectMeta: metav1.ObjectMeta{Labels: labels},
+								Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+							},
+						},
+					},
+					&corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: namespace, Labels: labels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+					})
+			}
+			client := fake.NewSimpleClientset(objects...)
+			handler.clientSet = client
+
+			opts := NewBackfillOptions()
+			opts.Namespaces = c.namespaces
+			if err := handler.Backfill(context.TODO(), opts, &bytes.Buffer{}); err != nil {
+				t.Fatal(err)
+			}
+
+			patched := []string{}
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "patch" {
+					patched = append(patched, action.GetNamespace())
+				}
+			}
+			if len(patched) != 1 || patched[0] != "shop" {
+				t.Fatalf("expected only the deployment in shop patched, got patches in %v", patched)
+			}
+		})
+	}
+}
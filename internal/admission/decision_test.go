@@ -0,0 +1,200 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	admission "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+const decisionPod = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+  annotations: {}
+spec:
+  containers:
+  - name: app
+    image: app
+`
+
+const decisionDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations: {}
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+      annotations: {}
+    spec:
+      containers:
+      - name: app
+        image: app
+`
+
+// TestWebhookAndInjectDecideTheSame check the webhook, the inject command and its KRM function produce
+// the same object from the same annotations
+func TestWebhookAndInjectDecideTheSame(t *testing.T) {
+	cases := []struct {
+		name               string
+		kind               string
+		document           string
+		injectByDefault    bool
+		annotations        map[string]string
+		templateAnnotation map[string]string
+		regionTimezones    map[string]string
+		injected           bool
+	}{
+		{name: "default", kind: podKind, document: decisionPod, injectByDefault: true, injected: true},
+		{name: "disabled by default", kind: podKind, document: decisionPod},
+		{name: "requested", kind: podKind, document: decisionPod, annotations: map[string]string{internal.InjectAnnotation: "true"}, injected: true},
+		{name: "explicitly false", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.InjectAnnotation: "false"}},
+		{name: "already injected", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.InjectedAnnotation: "true"}},
+		{name: "timezone", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.TimezoneAnnotation: "Europe/Paris"}, injected: true},
+		{name: "deprecated timezone", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.TimezoneAnnotation: "Asia/Calcutta"}, injected: true},
+		{name: "strategy", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.InjectionStrategyAnnotation: string(inject.HostPathInjectionStrategy)}, injected: true},
+		{name: "container timezone", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.ContainerTimezoneAnnotationPrefix + "app": "UTC"}, injected: true},
+		{name: "region", kind: podKind, document: decisionPod, injectByDefault: true, annotations: map[string]string{internal.RegionAnnotation: "us-east-1"}, regionTimezones: map[string]string{"us-east-1": "America/New_York"}, injected: true},
+		{name: "deployment", kind: deploymentKind, document: decisionDeployment, injectByDefault: true, templateAnnotation: map[string]string{internal.TimezoneAnnotation: "Asia/Tokyo"}, injected: true},
+		{name: "deployment workload wins", kind: deploymentKind, document: decisionDeployment, injectByDefault: true, annotations: map[string]string{internal.TimezoneAnnotation: "Europe/Berlin"}, templateAnnotation: map[string]string{internal.TimezoneAnnotation: "Asia/Tokyo"}, injected: true},
+		{name: "deployment explicitly false", kind: deploymentKind, document: decisionDeployment, injectByDefault: true, templateAnnotation: map[string]string{internal.InjectAnnotation: "false"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			document := decisionDocument(t, c.document, c.annotations, c.templateAnnotation)
+
+			handler := NewRequestsHandler()
+			handler.InjectByDefault = c.injectByDefault
+			handler.RegionTimezones = c.regionTimezones
+			req := &admission.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Kind: c.kind},
+				Operation: admission.Create,
+				Namespace: "default",
+				Object:    runtime.RawExtension{Raw: document},
+			}
+			var (
+				patches internal.Patches
+				err     error
+			)
+			if c.kind == podKind {
+				patches, _, err = handler.handlePodAdmissionRequest(context.TODO(), req)
+			} else {
+				patches, _, err = handler.handleWorkloadAdmissionRequest(context.TODO(), req)
+			}
+			if err != nil {
+				t.Fatalf("webhook failed: %v", err)
+			}
+			webhook := applyDecisionPatches(t, document, patches)
+
+			generator := &inject.AnnotatedGenerator{PatchGenerator: inject.NewPatchGenerator(), InjectByDefault: c.injectByDefault, RegionTimezones: c.regionTimezones}
+			var typed interface{} = &appsv1.Deployment{}
+			if c.kind == podKind {
+				typed = &corev1.Pod{}
+			}
+			if err = json.Unmarshal(document, typed); err != nil {
+				t.Fatal(err)
+			}
+			if patches, err = generator.Generate(context.TODO(), typed, ""); err != nil {
+				t.Fatalf("inject failed: %v", err)
+			}
+			offline := applyDecisionPatches(t, document, patches)
+
+			if string(webhook) != string(offline) {
+				t.Fatalf("webhook and inject differ:\nwebhook: %s\ninject:  %s", webhook, offline)
+			}
+			if krm := runDecisionKRMFunction(t, document, *generator); string(webhook) != string(krm) {
+				t.Fatalf("webhook and KRM function differ:\nwebhook: %s\nkrm:     %s", webhook, krm)
+			}
+			if injected := string(webhook) != string(document); injected != c.injected {
+				t.Fatalf("expected injected %v, got %s", c.injected, webhook)
+			}
+		})
+	}
+}
+
+// decisionDocument return json of document with annotations set on object and pod template
+func decisionDocument(t *testing.T, document string, annotations, templateAnnotations map[string]string) []byte {
+	obj := map[string]interface{}{}
+	if err := yamlconvert.Unmarshal([]byte(document), &obj); err != nil {
+		t.Fatal(err)
+	}
+	setAnnotations := func(metadata interface{}, annotations map[string]string) {
+		if len(annotations) == 0 {
+			delete(metadata.(map[string]interface{}), "annotations")
+			return
+		}
+		metadata.(map[string]interface{})["annotations"] = annotations
+	}
+	setAnnotations(obj["metadata"], annotations)
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		if template, ok := spec["template"].(map[string]interface{}); ok {
+			setAnnotations(template["metadata"], templateAnnotations)
+		}
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// runDecisionKRMFunction run the KRM function on a ResourceList of document and return the normalized json of the item
+func runDecisionKRMFunction(t *testing.T, document []byte, generator inject.AnnotatedGenerator) []byte {
+	in, err := json.Marshal(map[string]interface{}{"kind": "ResourceList", "items": []json.RawMessage{document}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err = inject.RunKRMFunction(context.TODO(), bytes.NewReader(in), out, generator); err != nil {
+		t.Fatalf("KRM function failed: %v", err)
+	}
+	list := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	if err = yamlconvert.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 item, got %s", out.Bytes())
+	}
+	return applyDecisionPatches(t, list.Items[0], internal.Patches{})
+}
+
+// applyDecisionPatches apply patches and return the normalized json
+func applyDecisionPatches(t *testing.T, document []byte, patches internal.Patches) []byte {
+	data, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpatch.DecodePatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if document, err = patch.Apply(document); err != nil {
+		t.Fatal(err)
+	}
+	obj := map[string]interface{}{}
+	if err = json.Unmarshal(document, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if document, err = json.Marshal(obj); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
@@ -0,0 +1,98 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// Explanation is how the webhook decides the injection of an object
+type Explanation struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// NamespaceAnnotations are the annotations of namespace consulted
+	NamespaceAnnotations map[string]string
+	Decision             inject.Decision
+	// Warnings are returned to user by api-server
+	Warnings []string
+	// Patches would be produced by the webhook
+	Patches internal.Patches
+}
+
+// Explain run the same logic as admission request for a pod, deployment or statefulset in namespace,
+// objects in namespaces not handled by webhook are skipped, namespace annotations are read from cluster
+// when they are nil and namespace annotations are enabled
+func (h *RequestsHandler) Explain(ctx context.Context, namespace string, object interface{}, namespaceAnnotations map[string]string) (*Explanation, error) {
+	var (
+		err         error
+		explanation = &Explanation{Namespace: namespace}
+		pod         *corev1.Pod // pod whose annotations are consulted
+	)
+	switch o := object.(type) {
+	case *corev1.Pod:
+		explanation.Kind, explanation.Name, pod = podKind, o.Name, o
+	case *appsv1.Deployment:
+		explanation.Kind, explanation.Name, pod = deploymentKind, o.Name, workloadPod(&o.ObjectMeta, &o.Spec.Template)
+		pod.Annotations = mergeInjected(pod.Annotations, o.Spec.Template.Annotations)
+	case *appsv1.StatefulSet:
+		explanation.Kind, explanation.Name, pod = statefulSetKind, o.Name, workloadPod(&o.ObjectMeta, &o.Spec.Template)
+		pod.Annotations = mergeInjected(pod.Annotations, o.Spec.Template.Annotations)
+	default:
+		return nil, fmt.Errorf("not injectable object: %T", object)
+	}
+
+	if !h.handledNamespace(namespace) {
+		explanation.Decision.Reason = fmt.Sprintf("namespace %s is not handled by webhook", namespace)
+		return explanation, nil
+	}
+
+	if namespaceAnnotations == nil && h.InjectNamespaceAnnotation && h.clientSet != nil {
+		if namespaceAnnotations, err = h.namespaceAnnotations(ctx, namespace); err != nil {
+			return nil, err
+		}
+	}
+	explanation.NamespaceAnnotations = namespaceAnnotations
+	annotations, err := h.podAnnotations(ctx, namespace, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation.Decision = h.annotatedGenerator(namespace).Decide(annotations, namespaceAnnotations, pod.Labels, &pod.Spec)
+	explanation.Warnings = explanation.Decision.Warnings
+	if explanation.Decision.Generator == nil {
+		return explanation, nil
+	}
+	if err = h.selectNodeLabelStrategy(ctx, pod, &explanation.Decision); err != nil {
+		return nil, err
+	}
+	explanation.Warnings = append(explanation.Warnings, containerTZWarnings(pod, explanation.Decision.Generator)...)
+
+	if explanation.Patches, err = explanation.Decision.Generator.Generate(ctx, object, ""); err != nil {
+		return nil, fmt.Errorf("failed to generate patches, error: %w", err)
+	}
+	return explanation, nil
+}
+
+// mergeInjected keep the injected annotation of pod template, which workloadPod drop for re-rendering
+func mergeInjected(annotations, template map[string]string) map[string]string {
+	if value, ok := internal.LookupAnnotation(template, internal.InjectedAnnotation); ok {
+		annotations[internal.InjectedAnnotation] = value
+	}
+	return annotations
+}
+
+// GetPod read pod from cluster
+func (h *RequestsHandler) GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	pod, err := h.clientSet.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s/%s, error: %w", namespace, name, err)
+	}
+	return pod, nil
+}
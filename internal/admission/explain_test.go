@@ -0,0 +1,44 @@
+package admission
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestExplainNamespaceGate check explain skip namespaces the webhook does not handle
+func TestExplainNamespaceGate(t *testing.T) {
+	handler := NewRequestsHandler()
+	handler.ZoneInfoNamespaces = "shop"
+	handler.InitWebHookNamespace()
+
+	cases := []struct {
+		namespace string
+		injected  bool
+	}{
+		{namespace: "shop", injected: true},
+		{namespace: "billing"},
+		{namespace: metav1.NamespaceSystem},
+		{namespace: metav1.NamespacePublic},
+	}
+	for _, c := range cases {
+		t.Run(c.namespace, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: c.namespace},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+			}
+			explanation, err := handler.Explain(context.TODO(), c.namespace, pod, map[string]string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if injected := explanation.Decision.Generator != nil; injected != c.injected {
+				t.Fatalf("expected injected %v, got %v: %s", c.injected, injected, explanation.Decision.Reason)
+			}
+			if injected := len(explanation.Patches) > 0; injected != c.injected {
+				t.Fatalf("expected patches %v, got %v", c.injected, explanation.Patches)
+			}
+		})
+	}
+}
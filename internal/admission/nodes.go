@@ -0,0 +1,194 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/informers"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+	"github.com/m198799/timezone-webhook/internal/log"
+)
+
+const (
+	// NodeLabelsSource is the strategy chosen from labels of the nodes pod is eligible for
+	NodeLabelsSource inject.Source = "node-labels"
+	// nodeResync is the resync period of node informer
+	nodeResync = 10 * time.Minute
+)
+
+// startNodeLister start node informer and wait for its cache synced
+func (h *RequestsHandler) startNodeLister(stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(h.clientSet, nodeResync)
+	lister := factory.Core().V1().Nodes().Lister()
+	factory.Start(stopCh)
+	for informer, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return fmt.Errorf("failed to sync node cache of %v", informer)
+		}
+	}
+	h.nodes = lister
+	return nil
+}
+
+// listNodes read nodes from cache if node lister started, else from api-server
+func (h *RequestsHandler) listNodes(ctx context.Context) ([]*corev1.Node, error) {
+	if h.nodes != nil {
+		return h.nodes.List(labels.Everything())
+	}
+	list, err := h.clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*corev1.Node, 0, len(list.Items))
+	for i := range list.Items {
+		nodes = append(nodes, &list.Items[i])
+	}
+	return nodes, nil
+}
+
+// selectNodeLabelStrategy choose hostPath strategy when every node pod is eligible for declares tzdata by
+// HostPathNodeLabel, else configmap strategy. It only applies when strategy is not set by annotations.
+// It is a label-based selection at admission, not a check of the node pod is scheduled to: eligibility only
+// approximates the scheduler by node selector, required node affinity and taints, and the label is trusted.
+// The strategy is decided at admission because volumes of a pod could not be changed after it is created,
+// deferring it to a scheduling gate needs schedulingGates of PodSpec which k8s.io/api v0.24 does not have
+func (h *RequestsHandler) selectNodeLabelStrategy(ctx context.Context, pod *corev1.Pod, decision *inject.Decision) error {
+	if !h.NodeLabelStrategy || h.clientSet == nil || decision.Generator == nil || strategySource(decision) != inject.DefaultSource {
+		return nil
+	}
+	key, value := inject.ParseNodeLabel(h.HostPathNodeLabel)
+	if key == "" {
+		return nil
+	}
+
+	nodes, err := h.listNodes(ctx)
+	if err != nil {
+		return newClassifiedError(NodeErrorClass, fmt.Errorf("failed to list nodes: %w", err))
+	}
+	eligible, withTZData := 0, 0
+	for _, node := range nodes {
+		if !nodeEligible(&pod.Spec, node) {
+			continue
+		}
+		eligible++
+		if v, ok := node.Labels[key]; ok && v == value {
+			withTZData++
+		}
+	}
+	if eligible == 0 {
+		log.Info(fmt.Sprintf("no node is eligible for pod (%s/%s), keep strategy %s", pod.Namespace, pod.Name, decision.Generator.Strategy))
+		return nil
+	}
+
+	decision.Generator.Strategy = inject.ConfigMapInjectionStrategy
+	if withTZData == eligible {
+		decision.Generator.Strategy = inject.HostPathInjectionStrategy
+	}
+	decision.Rules = append(decision.Rules, inject.Rule{Name: internal.InjectionStrategyAnnotation, Source: NodeLabelsSource, Value: string(decision.Generator.Strategy)})
+	log.Info(fmt.Sprintf("%d of %d nodes eligible for pod (%s/%s) have tzdata, strategy is %s", withTZData, eligible, pod.Namespace, pod.Name, decision.Generator.Strategy))
+	return nil
+}
+
+// strategySource return where the strategy of decision comes from
+func strategySource(decision *inject.Decision) inject.Source {
+	for _, rule := range decision.Rules {
+		if rule.Name == internal.InjectionStrategyAnnotation {
+			return rule.Source
+		}
+	}
+	return inject.NoSource
+}
+
+// nodeEligible report whether node matches node selector and required node affinity of spec,
+// and every NoSchedule or NoExecute taint of node is tolerated by spec
+func nodeEligible(spec *corev1.PodSpec, node *corev1.Node) bool {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if spec.NodeName != "" && spec.NodeName != node.Name {
+		return false
+	}
+	if !taintsTolerated(spec.Tolerations, node.Spec.Taints) {
+		return false
+	}
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil || spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	// terms are ORed
+	for _, term := range spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if termMatches(term, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// taintsTolerated report whether every taint which keeps pods off node is tolerated,
+// PreferNoSchedule taints do not make node ineligible
+func taintsTolerated(tolerations []corev1.Toleration, taints []corev1.Taint) bool {
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect != corev1.TaintEffectNoSchedule && taint.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// termMatches report whether node matches every requirement of term, an empty term matches nothing
+func termMatches(term corev1.NodeSelectorTerm, node *corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, expr := range term.MatchExpressions {
+		if !requirementMatches(expr, labels.Set(node.Labels)) {
+			return false
+		}
+	}
+	for _, field := range term.MatchFields {
+		if field.Key != "metadata.name" || !requirementMatches(field, labels.Set{field.Key: node.Name}) {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeSelectorOperators map node selector operator to label selector operator
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// requirementMatches report whether set matches requirement, an invalid requirement matches nothing
+func requirementMatches(requirement corev1.NodeSelectorRequirement, set labels.Set) bool {
+	op, ok := nodeSelectorOperators[requirement.Operator]
+	if !ok {
+		return false
+	}
+	r, err := labels.NewRequirement(requirement.Key, op, requirement.Values)
+	if err != nil {
+		return false
+	}
+	return r.Matches(set)
+}
@@ -0,0 +1,72 @@
+package admission
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// TestNodeLabelStrategy check hostPath is chosen only when every eligible node has tzdata
+func TestNodeLabelStrategy(t *testing.T) {
+	node := func(name string, labels map[string]string, taints ...corev1.Taint) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}, Spec: corev1.NodeSpec{Taints: taints}}
+	}
+	handler := NewRequestsHandler()
+	handler.NodeLabelStrategy = true
+	handler.HostPathNodeLabel = "tzdata"
+	handler.clientSet = fake.NewSimpleClientset(
+		node("full", map[string]string{"tzdata": "true", "os": "full"}),
+		node("distroless", map[string]string{"os": "distroless"}),
+		node("gpu", map[string]string{"os": "full", "pool": "gpu"}, corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}),
+		node("spot", map[string]string{"tzdata": "true", "os": "full", "pool": "spot"}, corev1.Taint{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}),
+	)
+
+	cases := []struct {
+		name         string
+		nodeSelector map[string]string
+		affinity     *corev1.Affinity
+		tolerations  []corev1.Toleration
+		annotations  map[string]string
+		strategy     inject.InjectionStrategy
+	}{
+		{name: "mixed fleet", strategy: inject.ConfigMapInjectionStrategy},
+		{name: "pinned to full os", nodeSelector: map[string]string{"os": "full"}, strategy: inject.HostPathInjectionStrategy},
+		{name: "tolerate tainted node", nodeSelector: map[string]string{"os": "full"}, tolerations: []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}},
+			strategy: inject.ConfigMapInjectionStrategy},
+		{name: "only untolerated node", nodeSelector: map[string]string{"pool": "gpu"}, strategy: handler.DefaultInjectionStrategy},
+		{name: "prefer no schedule", nodeSelector: map[string]string{"pool": "spot"}, strategy: inject.HostPathInjectionStrategy},
+		{name: "affinity to full os", affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "os", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"distroless"}}},
+			}}},
+		}}, strategy: inject.HostPathInjectionStrategy},
+		{name: "no eligible node", nodeSelector: map[string]string{"os": "windows"}, strategy: handler.DefaultInjectionStrategy},
+		{name: "annotation wins", annotations: map[string]string{internal.InjectionStrategyAnnotation: string(inject.HostPathInjectionStrategy)}, strategy: inject.HostPathInjectionStrategy},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: c.annotations},
+				Spec: corev1.PodSpec{
+					NodeSelector: c.nodeSelector,
+					Affinity:     c.affinity,
+					Tolerations:  c.tolerations,
+					Containers:   []corev1.Container{{Name: "app", Image: "app"}},
+				},
+			}
+			generator, _, err := handler.lookupPod(context.TODO(), "default", pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if generator.Strategy != c.strategy {
+				t.Fatalf("expected strategy %s, got %s", c.strategy, generator.Strategy)
+			}
+		})
+	}
+}
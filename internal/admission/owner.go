@@ -0,0 +1,226 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+	"github.com/m198799/timezone-webhook/internal/log"
+)
+
+const (
+	// maxOwnerDepth stop walking owner references, CronJob->Job->Pod is the longest known chain
+	maxOwnerDepth = 4
+	// ownerResync is the resync period of owner informers
+	ownerResync = 10 * time.Minute
+)
+
+// ownerGetter read the owners of a pod
+type ownerGetter interface {
+	replicaSet(ctx context.Context, namespace, name string) (*appsv1.ReplicaSet, error)
+	deployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error)
+	statefulSet(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error)
+	daemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error)
+	job(ctx context.Context, namespace, name string) (*batchv1.Job, error)
+	cronJob(ctx context.Context, namespace, name string) (*batchv1.CronJob, error)
+}
+
+// listerOwners read owners from informer cache, it is used by webhook
+type listerOwners struct {
+	replicaSets  appslisters.ReplicaSetLister
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	daemonSets   appslisters.DaemonSetLister
+	jobs         batchlisters.JobLister
+	cronJobs     batchlisters.CronJobLister
+}
+
+func (l *listerOwners) replicaSet(_ context.Context, namespace, name string) (*appsv1.ReplicaSet, error) {
+	return l.replicaSets.ReplicaSets(namespace).Get(name)
+}
+
+func (l *listerOwners) deployment(_ context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	return l.deployments.Deployments(namespace).Get(name)
+}
+
+func (l *listerOwners) statefulSet(_ context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+	return l.statefulSets.StatefulSets(namespace).Get(name)
+}
+
+func (l *listerOwners) daemonSet(_ context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+	return l.daemonSets.DaemonSets(namespace).Get(name)
+}
+
+func (l *listerOwners) job(_ context.Context, namespace, name string) (*batchv1.Job, error) {
+	return l.jobs.Jobs(namespace).Get(name)
+}
+
+func (l *listerOwners) cronJob(_ context.Context, namespace, name string) (*batchv1.CronJob, error) {
+	return l.cronJobs.CronJobs(namespace).Get(name)
+}
+
+// clientOwners read owners from api-server, it is used by commands which run once
+type clientOwners struct {
+	handler *RequestsHandler
+}
+
+func (c *clientOwners) replicaSet(ctx context.Context, namespace, name string) (*appsv1.ReplicaSet, error) {
+	return c.handler.clientSet.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clientOwners) deployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	return c.handler.clientSet.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clientOwners) statefulSet(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+	return c.handler.clientSet.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clientOwners) daemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+	return c.handler.clientSet.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clientOwners) job(ctx context.Context, namespace, name string) (*batchv1.Job, error) {
+	return c.handler.clientSet.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clientOwners) cronJob(ctx context.Context, namespace, name string) (*batchv1.CronJob, error) {
+	return c.handler.clientSet.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// startOwnerListers start informers of the owners and wait for their cache synced
+func (h *RequestsHandler) startOwnerListers(stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(h.clientSet, ownerResync)
+	owners := &listerOwners{
+		replicaSets:  factory.Apps().V1().ReplicaSets().Lister(),
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+		daemonSets:   factory.Apps().V1().DaemonSets().Lister(),
+		jobs:         factory.Batch().V1().Jobs().Lister(),
+		cronJobs:     factory.Batch().V1().CronJobs().Lister(),
+	}
+	factory.Start(stopCh)
+	for informer, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return fmt.Errorf("failed to sync owner cache of %v", informer)
+		}
+	}
+	h.owners = owners
+	return nil
+}
+
+// ownerGetter return the cached listers if started, else read owners from api-server
+func (h *RequestsHandler) ownerGetter() ownerGetter {
+	if h.owners != nil {
+		return h.owners
+	}
+	return &clientOwners{handler: h}
+}
+
+// ownerAnnotations walk the controller owner references of pod, e.g. ReplicaSet->Deployment and Job->CronJob,
+// and return the decision annotations of owners, a nearer owner wins over a farther one. Annotations
+// on a workload win over the ones on its pod template
+func (h *RequestsHandler) ownerAnnotations(ctx context.Context, namespace string, owners []metav1.OwnerReference) (map[string]string, error) {
+	if !h.ResolveOwners || h.clientSet == nil {
+		return nil, nil
+	}
+
+	var levels []map[string]string // annotations of every owner, nearest first
+	getter := h.ownerGetter()
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+		ref := metav1.GetControllerOfNoCopy(&metav1.ObjectMeta{OwnerReferences: owners})
+		if ref == nil {
+			break
+		}
+		annotations, next, err := ownerOf(ctx, getter, namespace, ref)
+		if apierrors.IsNotFound(err) {
+			log.Info(fmt.Sprintf("owner %s %s/%s not found, stop walking owners", ref.Kind, namespace, ref.Name))
+			break
+		} else if err != nil {
+			return nil, newClassifiedError(OwnerErrorClass, fmt.Errorf("failed to lookup owner %s %s/%s: %w", ref.Kind, namespace, ref.Name, err))
+		} else if next == nil && annotations == nil {
+			break
+		}
+		levels = append(levels, annotations)
+		owners = next
+	}
+
+	inherited := map[string]string{}
+	for i := len(levels) - 1; i >= 0; i-- {
+		for k, v := range internal.NormalizeAnnotations(levels[i]) {
+			if isDecisionAnnotation(k) {
+				inherited[k] = v
+			}
+		}
+	}
+	return inherited, nil
+}
+
+// ownerOf return annotations and owner references of the owner ref points to, both nil for unknown kinds
+func ownerOf(ctx context.Context, getter ownerGetter, namespace string, ref *metav1.OwnerReference) (map[string]string, []metav1.OwnerReference, error) {
+	switch {
+	case ref.APIVersion == "apps/v1" && ref.Kind == "ReplicaSet":
+		o, err := getter.replicaSet(ctx, namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inject.MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.OwnerReferences, nil
+	case ref.APIVersion == "apps/v1" && ref.Kind == deploymentKind:
+		o, err := getter.deployment(ctx, namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inject.MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.OwnerReferences, nil
+	case ref.APIVersion == "apps/v1" && ref.Kind == statefulSetKind:
+		o, err := getter.statefulSet(ctx, namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inject.MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.OwnerReferences, nil
+	case ref.APIVersion == "apps/v1" && ref.Kind == "DaemonSet":
+		o, err := getter.daemonSet(ctx, namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inject.MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.OwnerReferences, nil
+	case ref.APIVersion == "batch/v1" && ref.Kind == "Job":
+		o, err := getter.job(ctx, namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inject.MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.OwnerReferences, nil
+	case ref.APIVersion == "batch/v1" && ref.Kind == "CronJob":
+		o, err := getter.cronJob(ctx, namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inject.MergeAnnotations(o.Spec.JobTemplate.Spec.Template.Annotations, o.Spec.JobTemplate.Annotations, o.Annotations), o.OwnerReferences, nil
+	}
+	return nil, nil, nil
+}
+
+// isDecisionAnnotation report whether key is consulted by the decision engine
+func isDecisionAnnotation(key string) bool {
+	if strings.HasPrefix(key, internal.ContainerTimezoneAnnotationPrefix) {
+		return true
+	}
+	// post-injection annotations are not inherited
+	for _, k := range []string{internal.InjectAnnotation, internal.TimezoneAnnotation, internal.InjectionStrategyAnnotation,
+		internal.RegionAnnotation, internal.EnvTemplatesAnnotation} {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package admission
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// TestOwnerAnnotations check pods of CronJob inherit its annotations, and the nearer owner wins
+func TestOwnerAnnotations(t *testing.T) {
+	isController := true
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default", Annotations: map[string]string{
+			internal.TimezoneAnnotation:          "America/New_York",
+			internal.InjectionStrategyAnnotation: "hostPath",
+		}},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "report-1", Namespace: "default",
+			Annotations:     map[string]string{internal.TimezoneAnnotation: "Europe/Paris", "unrelated": "x"},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &isController}},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "report-1-abcde", Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "report-1", Controller: &isController}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+	}
+
+	handler := NewRequestsHandler()
+	handler.ResolveOwners = true
+	handler.clientSet = fake.NewSimpleClientset(cronJob, job)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := handler.startOwnerListers(stopCh); err != nil {
+		t.Fatal(err)
+	}
+
+	generator, _, err := handler.lookupPod(context.TODO(), "default", pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generator.Timezone != "Europe/Paris" || generator.Strategy != "hostPath" {
+		t.Fatalf("expected Europe/Paris from job and hostPath from cronjob, got %s/%s", generator.Timezone, generator.Strategy)
+	}
+}
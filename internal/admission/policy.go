@@ -0,0 +1,172 @@
+// Package admission ...
+package admission
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	admission "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal/log"
+)
+
+// ErrorPolicy decide how the webhook answers api-server when injection failed
+type ErrorPolicy string
+
+const (
+	// RejectErrorPolicy deny the admission request, the pod will not be created
+	RejectErrorPolicy ErrorPolicy = "reject"
+	// AllowUnpatchedErrorPolicy admit the object without any patch
+	AllowUnpatchedErrorPolicy ErrorPolicy = "allow-unpatched"
+	// AllowWithWarningErrorPolicy admit the object without any patch and return the error as admission warning
+	AllowWithWarningErrorPolicy ErrorPolicy = "allow-with-warning"
+
+	// DefaultErrorPolicy keep the historical behavior when no error policy is set, reject on every error
+	// except the classes in classErrorPolicies
+	DefaultErrorPolicy = RejectErrorPolicy
+)
+
+// classErrorPolicies keep the historical behavior of classes which never rejected, e.g. a namespace lookup
+// failure admitted the pod. They only apply when no error policy is set, and are overridden by ErrorPolicyOverrides
+var classErrorPolicies = map[ErrorClass]ErrorPolicy{
+	NamespaceErrorClass: AllowWithWarningErrorPolicy,
+}
+
+// ErrorClass is the category of an error happened while handling admission request
+type ErrorClass string
+
+const (
+	// DecodeErrorClass object in the admission request could not be deserialized
+	DecodeErrorClass ErrorClass = "decode"
+	// NamespaceErrorClass namespace of the object could not be read from api-server
+	NamespaceErrorClass ErrorClass = "namespace"
+	// NodeErrorClass nodes could not be listed for node label strategy
+	NodeErrorClass ErrorClass = "node"
+	// OwnerErrorClass owners of the pod could not be read
+	OwnerErrorClass ErrorClass = "owner"
+	// GenerateErrorClass patches could not be generated, e.g. unknown strategy annotation
+	GenerateErrorClass ErrorClass = "generate"
+	// InternalErrorClass any error not classified
+	InternalErrorClass ErrorClass = "internal"
+)
+
+// ErrorClasses all known error classes
+var ErrorClasses = []ErrorClass{DecodeErrorClass, NamespaceErrorClass, OwnerErrorClass, NodeErrorClass, GenerateErrorClass, InternalErrorClass}
+
+// classifiedError wrap an error with its ErrorClass
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// newClassifiedError wrap err in class, nil err return nil
+func newClassifiedError(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// classOf read ErrorClass from err, not classified error is InternalErrorClass
+func classOf(err error) ErrorClass {
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	return InternalErrorClass
+}
+
+// ParseErrorPolicy check policy is a known ErrorPolicy
+func ParseErrorPolicy(policy string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(policy); p {
+	case RejectErrorPolicy, AllowUnpatchedErrorPolicy, AllowWithWarningErrorPolicy:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown error policy %q, must be one of %s, %s, %s", policy,
+		RejectErrorPolicy, AllowUnpatchedErrorPolicy, AllowWithWarningErrorPolicy)
+}
+
+// initErrorPolicies validate DefaultErrorPolicy and ErrorPolicyOverrides from flags, empty DefaultErrorPolicy is not set
+func (h *RequestsHandler) initErrorPolicies() error {
+	if h.DefaultErrorPolicy != "" {
+		if _, err := ParseErrorPolicy(string(h.DefaultErrorPolicy)); err != nil {
+			return err
+		}
+	}
+
+	h.errorPolicies = make(map[ErrorClass]ErrorPolicy, len(h.ErrorPolicyOverrides))
+	for class, policy := range h.ErrorPolicyOverrides {
+		if !isKnownErrorClass(ErrorClass(class)) {
+			return fmt.Errorf("unknown error class %q, must be one of %s", class, joinErrorClasses())
+		}
+		p, err := ParseErrorPolicy(policy)
+		if err != nil {
+			return err
+		}
+		h.errorPolicies[ErrorClass(class)] = p
+	}
+	return nil
+}
+
+// errorPolicyFor return the policy configured for class, then the configured DefaultErrorPolicy, the historical
+// policy of class and DefaultErrorPolicy are only used when no error policy is set
+func (h *RequestsHandler) errorPolicyFor(class ErrorClass) ErrorPolicy {
+	if p, ok := h.errorPolicies[class]; ok {
+		return p
+	}
+	if h.DefaultErrorPolicy != "" {
+		return h.DefaultErrorPolicy
+	}
+	if p, ok := classErrorPolicies[class]; ok {
+		return p
+	}
+	return DefaultErrorPolicy
+}
+
+// applyErrorPolicy fill response according to the policy of err class
+func (h *RequestsHandler) applyErrorPolicy(response *admission.AdmissionResponse, req *admission.AdmissionRequest, err error) {
+	class := classOf(err)
+	policy := h.errorPolicyFor(class)
+	switch policy {
+	case AllowUnpatchedErrorPolicy:
+		log.Warn("admitting request unpatched:", "Namespace: ", req.Namespace, "Name: ", req.Name, "class: ", class, "err: ", err)
+		response.Allowed = true
+	case AllowWithWarningErrorPolicy:
+		log.Warn("admitting request unpatched with warning:", "Namespace: ", req.Namespace, "Name: ", req.Name, "class: ", class, "err: ", err)
+		response.Allowed = true
+		response.Warnings = append(response.Warnings, fmt.Sprintf("timezone was not injected: %s", err.Error()))
+	default:
+		log.Warn("rejecting request:", "Namespace: ", req.Namespace, "Name: ", req.Name, "class: ", class, "err: ", err)
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Message: err.Error(),
+		}
+	}
+}
+
+func isKnownErrorClass(class ErrorClass) bool {
+	for _, c := range ErrorClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func joinErrorClasses() string {
+	classes := make([]string, 0, len(ErrorClasses))
+	for _, c := range ErrorClasses {
+		classes = append(classes, string(c))
+	}
+	return strings.Join(classes, ", ")
+}
@@ -0,0 +1,44 @@
+package admission
+
+import (
+	"errors"
+	"testing"
+
+	admission "k8s.io/api/admission/v1beta1"
+)
+
+// TestErrorPolicy check namespace errors keep admitting pods unless an error policy is set or overridden
+func TestErrorPolicy(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    ErrorPolicy
+		overrides map[string]string
+		class     ErrorClass
+		allowed   bool
+	}{
+		{name: "namespace admitted by default", class: NamespaceErrorClass, allowed: true},
+		{name: "generate rejected by default", class: GenerateErrorClass},
+		{name: "namespace overridden", overrides: map[string]string{string(NamespaceErrorClass): string(RejectErrorPolicy)}, class: NamespaceErrorClass},
+		{name: "namespace rejected by policy", policy: RejectErrorPolicy, class: NamespaceErrorClass},
+		{name: "generate admitted by policy", policy: AllowUnpatchedErrorPolicy, class: GenerateErrorClass, allowed: true},
+		{name: "override wins over policy", policy: RejectErrorPolicy, overrides: map[string]string{string(NamespaceErrorClass): string(AllowUnpatchedErrorPolicy)},
+			class: NamespaceErrorClass, allowed: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := NewRequestsHandler()
+			handler.DefaultErrorPolicy = c.policy
+			if c.overrides != nil {
+				handler.ErrorPolicyOverrides = c.overrides
+			}
+			if err := handler.initErrorPolicies(); err != nil {
+				t.Fatal(err)
+			}
+			response := &admission.AdmissionResponse{}
+			handler.applyErrorPolicy(response, &admission.AdmissionRequest{}, newClassifiedError(c.class, errors.New("failed")))
+			if response.Allowed != c.allowed {
+				t.Fatalf("expected allowed %v, got %v", c.allowed, response.Allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package admission
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	yamlconvert "sigs.k8s.io/yaml"
+)
+
+// TimezoneSchedule switch the default timezone of webhook at a defined moment, e.g. migrating a product
+// from UTC to local time. Annotations of object and namespace still win over it
+type TimezoneSchedule struct {
+	// Timezone is injected by default once the schedule is effective
+	Timezone string `json:"timezone"`
+	// EffectiveFrom is the cutover moment, RFC3339
+	EffectiveFrom metav1.Time `json:"effectiveFrom"`
+	// Namespaces is the rollout order, the schedule only apply to them if not empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceInterval delay the cutover of every namespace after the previous one in rollout order
+	NamespaceInterval metav1.Duration `json:"namespaceInterval,omitempty"`
+}
+
+// LoadTimezoneSchedules read schedules from a yaml list, they are sorted by EffectiveFrom
+func LoadTimezoneSchedules(path string) ([]TimezoneSchedule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timezone schedules file %s, error: %w", path, err)
+	}
+	var schedules []TimezoneSchedule
+	if err = yamlconvert.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to read timezone schedules file %s, error: %w", path, err)
+	}
+	for i, s := range schedules {
+		if s.Timezone == "" {
+			return nil, fmt.Errorf("timezone schedule %d has no timezone", i)
+		}
+		if s.EffectiveFrom.IsZero() {
+			return nil, fmt.Errorf("timezone schedule %d (%s) has no effectiveFrom", i, s.Timezone)
+		}
+		if s.NamespaceInterval.Duration < 0 {
+			return nil, fmt.Errorf("timezone schedule %d (%s) has negative namespaceInterval", i, s.Timezone)
+		}
+	}
+	sort.SliceStable(schedules, func(i, j int) bool {
+		return schedules[i].EffectiveFrom.Before(&schedules[j].EffectiveFrom)
+	})
+	return schedules, nil
+}
+
+// effectiveAt return when the schedule is effective in namespace, false if namespace is not in rollout order
+func (s *TimezoneSchedule) effectiveAt(namespace string) (time.Time, bool) {
+	if len(s.Namespaces) == 0 {
+		return s.EffectiveFrom.Time, true
+	}
+	for i, ns := range s.Namespaces {
+		if ns == namespace {
+			return s.EffectiveFrom.Add(time.Duration(i) * s.NamespaceInterval.Duration), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// activeSchedule return the schedule effective in namespace at now which cut over last, nil if none
+func activeSchedule(schedules []TimezoneSchedule, namespace string, now time.Time) *TimezoneSchedule {
+	var (
+		active *TimezoneSchedule
+		since  time.Time
+	)
+	for i := range schedules {
+		at, ok := schedules[i].effectiveAt(namespace)
+		if !ok || at.After(now) {
+			continue
+		}
+		if active == nil || !at.Before(since) {
+			active, since = &schedules[i], at
+		}
+	}
+	return active
+}
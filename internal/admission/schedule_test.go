@@ -0,0 +1,51 @@
+package admission
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const schedulesFile = `
+- timezone: Europe/Berlin
+  effectiveFrom: "2026-03-01T00:00:00Z"
+  namespaces: [staging, production]
+  namespaceInterval: 24h
+- timezone: Asia/Tokyo
+  effectiveFrom: "2026-01-01T00:00:00Z"
+`
+
+func TestActiveSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.yaml")
+	if err := os.WriteFile(path, []byte(schedulesFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	schedules, err := LoadTimezoneSchedules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		namespace string
+		now       string
+		timezone  string
+	}{
+		{namespace: "production", now: "2025-12-31T23:59:59Z"},
+		{namespace: "production", now: "2026-01-01T00:00:00Z", timezone: "Asia/Tokyo"},
+		{namespace: "staging", now: "2026-03-01T00:00:00Z", timezone: "Europe/Berlin"},
+		{namespace: "production", now: "2026-03-01T12:00:00Z", timezone: "Asia/Tokyo"},
+		{namespace: "production", now: "2026-03-02T00:00:00Z", timezone: "Europe/Berlin"},
+		{namespace: "default", now: "2026-06-01T00:00:00Z", timezone: "Asia/Tokyo"},
+	}
+	for _, c := range cases {
+		now, _ := time.Parse(time.RFC3339, c.now)
+		timezone := ""
+		if schedule := activeSchedule(schedules, c.namespace, now); schedule != nil {
+			timezone = schedule.Timezone
+		}
+		if timezone != c.timezone {
+			t.Errorf("%s at %s: expected %q, got %q", c.namespace, c.now, c.timezone, timezone)
+		}
+	}
+}
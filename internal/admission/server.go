@@ -10,8 +10,9 @@ import (
 
 	"go.uber.org/zap"
 	admission "k8s.io/api/admission/v1beta1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
@@ -37,7 +38,29 @@ type RequestsHandler struct {
 	ConfigMapName             string
 	ZoneInfoNamespaces        string
 	InjectNamespaceAnnotation bool
+	DefaultErrorPolicy        ErrorPolicy
+	ErrorPolicyOverrides      map[string]string
+	EnvTemplateNames          []string
+	TimezoneFilePath          string
+	ZoneInfoPath              string
+	MountLayouts              map[string]string
+	ZoneInfoMountDir          string
+	HostPathLayout            string
+	HostPathNodeLabel         string
+	RegionTimezones           map[string]string
+	LabelTimezones            []string
+	ResolveOwners             bool
+	NodeLabelStrategy         bool
+	EnvTemplatesFile          string
+	TimezoneSchedulesFile     string
 	clientSet                 kubernetes.Interface
+	errorPolicies             map[ErrorClass]ErrorPolicy
+	envTemplates              inject.EnvTemplates
+	mountLayouts              map[inject.InjectionStrategy]inject.MountLayout
+	timezoneSchedules         []TimezoneSchedule
+	labelTimezones            []inject.LabelTimezone
+	owners                    ownerGetter
+	nodes                     corelisters.NodeLister
 }
 
 // Server ..
@@ -69,6 +92,9 @@ func NewRequestsHandler() RequestsHandler {
 		HostPathPrefix:           inject.DefaultHostPathPrefix,
 		LocalTimePath:            inject.DefaultLocalTimePath,
 		ConfigMapName:            inject.DefaultZoneInfoConfigmapName,
+		ErrorPolicyOverrides:     map[string]string{},
+		MountLayouts:             map[string]string{},
+		RegionTimezones:          map[string]string{},
 	}
 }
 
@@ -103,8 +129,8 @@ func (h *RequestsHandler) InitializeClientSet(kubeConfPath string) error {
 	return nil
 }
 
-// initWebHookNamespace init webhook namespace
-func (h *RequestsHandler) initWebHookNamespace() {
+// InitWebHookNamespace init webhook namespace
+func (h *RequestsHandler) InitWebHookNamespace() {
 	if h.ZoneInfoNamespaces == "" {
 		h.ZoneInfoNamespaces = inject.DefaultNamespace
 	}
@@ -117,6 +143,24 @@ func (h *RequestsHandler) initWebHookNamespace() {
 	}
 }
 
+// InitGenerator load the built-in env templates and the ones in EnvTemplatesFile, parse MountLayouts
+// load TimezoneSchedulesFile and parse LabelTimezones
+func (h *RequestsHandler) InitGenerator() (err error) {
+	if h.envTemplates, err = inject.LoadEnvTemplates(h.EnvTemplatesFile); err != nil {
+		return err
+	}
+	if h.mountLayouts, err = inject.ParseMountLayouts(h.MountLayouts); err != nil {
+		return fmt.Errorf("invalid mount layout: %w", err)
+	}
+	if h.timezoneSchedules, err = LoadTimezoneSchedules(h.TimezoneSchedulesFile); err != nil {
+		return err
+	}
+	if h.labelTimezones, err = inject.ParseLabelTimezones(h.LabelTimezones); err != nil {
+		return err
+	}
+	return nil
+}
+
 // GetClientSet ...
 func (h *RequestsHandler) GetClientSet() kubernetes.Interface {
 	return h.clientSet
@@ -124,10 +168,29 @@ func (h *RequestsHandler) GetClientSet() kubernetes.Interface {
 
 // Start listen address to receive api-server webhook
 func (h *Server) Start(kubeconfigFlag string) error {
+	if err := h.Handler.initErrorPolicies(); err != nil {
+		return fmt.Errorf("invalid error policy: %w", err)
+	}
+	if err := h.Handler.InitGenerator(); err != nil {
+		return err
+	}
 	if err := h.Handler.InitializeClientSet(kubeconfigFlag); err != nil {
 		return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
 	}
-	h.Handler.initWebHookNamespace()
+	if h.Handler.ResolveOwners {
+		if err := h.Handler.startOwnerListers(wait.NeverStop); err != nil {
+			return fmt.Errorf("failed to start owner listers: %w", err)
+		}
+	}
+	if h.Handler.NodeLabelStrategy {
+		if h.Handler.HostPathNodeLabel == "" {
+			return fmt.Errorf("node label strategy requires hostpath-node-label")
+		}
+		if err := h.Handler.startNodeLister(wait.NeverStop); err != nil {
+			return fmt.Errorf("failed to start node lister: %w", err)
+		}
+	}
+	h.Handler.InitWebHookNamespace()
 	if err := inject.InitZoneInfoConfigmap(context.TODO(), h.Handler.GetClientSet(), h.Handler.ConfigMapName, strings.Split(h.Handler.ZoneInfoNamespaces, ",")); err != nil {
 		return fmt.Errorf("failed to init zoneinfo to configmap: %w", err)
 	}
@@ -180,12 +243,10 @@ func (h *RequestsHandler) handleFunc(w http.ResponseWriter, r *http.Request) {
 
 	reviewResponse.Response.Allowed = true
 
-	if patches, err := h.handleAdmissionReview(r.Context(), review); err != nil {
-		log.Warn("rejecting request:", "Namespace: ", review.Request.Namespace, "Name: ", review.Request.Name, "err: ", err)
-		reviewResponse.Response.Allowed = false
-		reviewResponse.Response.Result = &metav1.Status{
-			Message: err.Error(),
-		}
+	patches, warnings, err := h.handleAdmissionReview(r.Context(), review)
+	reviewResponse.Response.Warnings = warnings
+	if err != nil {
+		h.applyErrorPolicy(reviewResponse.Response, review.Request, err)
 	} else if patches != nil {
 		patchBytes, err := json.Marshal(patches)
 		if err != nil {
@@ -0,0 +1,43 @@
+// Package admission ...
+package admission
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// containerTZWarnings warn about containers which already set TZ to a different value, the injected TZ is
+// appended after it and wins, and per-container timezone annotations of containers which do not exist
+func containerTZWarnings(pod *corev1.Pod, generator *inject.PatchGenerator) []string {
+	var (
+		warnings   []string
+		containers = map[string]bool{} // names of containers in pod
+	)
+	for _, c := range pod.Spec.Containers {
+		containers[c.Name] = true
+		timezone := generator.TimezoneFor(c.Name)
+		for _, env := range c.Env {
+			if env.Name == inject.TZEnvName && env.Value != timezone {
+				warnings = append(warnings, fmt.Sprintf("container %q already sets TZ=%q, TZ=%q is appended after it and takes precedence", c.Name, env.Value, generator.TZValueFor(c.Name)))
+			}
+		}
+	}
+
+	var unknown []string
+	for key := range internal.NormalizeAnnotations(pod.Annotations) {
+		if name := strings.TrimPrefix(key, internal.ContainerTimezoneAnnotationPrefix); name != key && !containers[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		warnings = append(warnings, fmt.Sprintf("annotation %s%s does not match any container", internal.ContainerTimezoneAnnotationPrefix, name))
+	}
+	return warnings
+}
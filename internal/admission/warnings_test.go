@@ -0,0 +1,34 @@
+package admission
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// TestContainerTZWarnings check a container setting TZ to another value is warned that the injected TZ wins,
+// and a container timezone annotation without container is warned about
+func TestContainerTZWarnings(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{internal.ContainerTimezoneAnnotationPrefix + "proxy": "UTC"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "app", Env: []corev1.EnvVar{{Name: inject.TZEnvName, Value: "America/New_York"}}},
+			{Name: "same", Env: []corev1.EnvVar{{Name: inject.TZEnvName, Value: "Asia/Shanghai"}}},
+			{Name: "plain"},
+		}},
+	}
+	generator := inject.NewPatchGenerator()
+
+	expected := []string{
+		`container "app" already sets TZ="America/New_York", TZ="Asia/Shanghai" is appended after it and takes precedence`,
+		"annotation " + internal.ContainerTimezoneAnnotationPrefix + "proxy does not match any container",
+	}
+	if warnings := containerTZWarnings(pod, &generator); !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("expected warnings %q, got %q", expected, warnings)
+	}
+}
@@ -0,0 +1,153 @@
+// Package admission ...
+package admission
+
+import (
+	"context"
+	"fmt"
+
+	admission "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+	"github.com/m198799/timezone-webhook/internal/log"
+)
+
+const (
+	deploymentKind  = "Deployment"
+	statefulSetKind = "StatefulSet"
+	podKind         = "Pod"
+)
+
+// handleWorkloadAdmissionRequest handler deployment/statefulset create and update request,
+// a workload which was injected before is re-rendered when its timezone or strategy changed
+func (h *RequestsHandler) handleWorkloadAdmissionRequest(ctx context.Context, req *admission.AdmissionRequest) (internal.Patches, []string, error) {
+	var (
+		err       error
+		obj       interface{}              // decoded workload object
+		meta      *metav1.ObjectMeta       // metadata of workload
+		template  *corev1.PodTemplateSpec  // pod template of workload
+		patches   internal.Patches         // patches object record patch field
+		generated internal.Patches         // patches from generator
+		warnings  []string                 // warnings is returned to user by api-server
+		generator *inject.PatchGenerator   // generator is generator patches
+		previous  inject.InjectionStrategy // strategy of previous injection
+		// nodeSelectorStripped is true when node label of previous hostPath injection was removed
+		nodeSelectorStripped bool
+	)
+
+	switch req.Kind.Kind {
+	case deploymentKind:
+		deployment := &appsv1.Deployment{}
+		_, _, err = k8sDecode.Decode(req.Object.Raw, nil, deployment)
+		obj, meta, template = deployment, &deployment.ObjectMeta, &deployment.Spec.Template
+	case statefulSetKind:
+		statefulSet := &appsv1.StatefulSet{}
+		_, _, err = k8sDecode.Decode(req.Object.Raw, nil, statefulSet)
+		obj, meta, template = statefulSet, &statefulSet.ObjectMeta, &statefulSet.Spec.Template
+	default:
+		return nil, nil, nil
+	}
+	if err != nil {
+		log.Error("could not deserialize workload object", "kind", req.Kind.Kind, "err", err)
+		return nil, nil, newClassifiedError(DecodeErrorClass, fmt.Errorf("could not deserialize %s object: %v", req.Kind.Kind, err))
+	}
+
+	// the post-injection annotations on pod template record what was injected last time
+	_, injected := internal.LookupAnnotation(template.Annotations, internal.InjectedAnnotation)
+	injectedTimezone := inject.InjectedTimezone(template.Annotations)
+	injectedTimezones := inject.InjectedTimezones(&template.Spec, template.Annotations)
+	if injected {
+		previous = inject.InjectedStrategy(&template.Spec)
+		inject.StripPodSpec(&template.Spec, template.Annotations)
+		if previous == inject.HostPathInjectionStrategy {
+			nodeSelectorStripped = inject.StripNodeSelector(&template.Spec, h.HostPathNodeLabel)
+		}
+	}
+
+	if generator, warnings, err = h.lookupPod(ctx, req.Namespace, workloadPod(meta, template)); err != nil {
+		return nil, warnings, fmt.Errorf("failed to lookup generator, error: %w", err)
+	} else if generator == nil {
+		return nil, warnings, nil
+	}
+
+	if injected {
+		if generator.Timezone == injectedTimezone && generator.Strategy == previous && sameContainerTimezones(&template.Spec, generator, injectedTimezones) {
+			log.Info(fmt.Sprintf("skipping %s (%s/%s) because injection is unchanged", req.Kind.Kind, req.Namespace, meta.Name))
+			return nil, warnings, nil
+		}
+		log.Info(fmt.Sprintf("re-rendering %s (%s/%s) injection from %s/%s to %s/%s", req.Kind.Kind, req.Namespace, meta.Name,
+			previous, injectedTimezone, generator.Strategy, generator.Timezone))
+		patches = append(patches, replacePodSpecPatches(&template.Spec, "/spec/template/spec", nodeSelectorStripped)...)
+	}
+
+	if generated, err = generator.Generate(ctx, obj, ""); err != nil {
+		return nil, warnings, newClassifiedError(GenerateErrorClass, fmt.Errorf("failed to generate patches for %s, error: %w", req.Kind.Kind, err))
+	}
+	return append(patches, generated...), warnings, nil
+}
+
+// sameContainerTimezones report whether every container was injected with the TZ of generator
+func sameContainerTimezones(spec *corev1.PodSpec, generator *inject.PatchGenerator, injected map[string]string) bool {
+	for _, c := range spec.Containers {
+		if injected[c.Name] != generator.TZValueFor(c.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// workloadPod build a pod from workload to lookup generator, annotations on workload
+// take precedence over annotations on pod template. Injection only writes post-injection
+// annotations, so the timezone annotations left on workload are always set by user
+func workloadPod(meta *metav1.ObjectMeta, template *corev1.PodTemplateSpec) *corev1.Pod {
+	annotations := make(map[string]string, len(template.Annotations)+len(meta.Annotations))
+	for k, v := range template.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range meta.Annotations {
+		annotations[k] = v
+	}
+	for _, key := range internal.AnnotationAliases(internal.InjectedAnnotation) {
+		delete(annotations, key)
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        meta.Name,
+			Namespace:   meta.Namespace,
+			Labels:      template.Labels,
+			Annotations: annotations,
+		},
+		Spec: template.Spec,
+	}
+}
+
+// replacePodSpecPatches replace volumes, env and volume mounts with the stripped ones, and node selector
+// when its node label was stripped, so the new injection replaces the previous one instead of duplicating it
+func replacePodSpecPatches(spec *corev1.PodSpec, pathPrefix string, nodeSelectorStripped bool) internal.Patches {
+	patches := internal.Patches{{
+		Op:    "add",
+		Path:  fmt.Sprintf("%s/volumes", pathPrefix),
+		Value: spec.Volumes,
+	}}
+	if nodeSelectorStripped && len(spec.NodeSelector) == 0 {
+		patches = append(patches, internal.Patch{Op: "remove", Path: fmt.Sprintf("%s/nodeSelector", pathPrefix)})
+	} else if nodeSelectorStripped {
+		patches = append(patches, internal.Patch{Op: "add", Path: fmt.Sprintf("%s/nodeSelector", pathPrefix), Value: spec.NodeSelector})
+	}
+	for containerID, container := range spec.Containers {
+		patches = append(patches, internal.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/containers/%d/env", pathPrefix, containerID),
+			Value: container.Env,
+		}, internal.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathPrefix, containerID),
+			Value: container.VolumeMounts,
+		})
+	}
+	return patches
+}
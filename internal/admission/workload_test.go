@@ -0,0 +1,231 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admission "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/m198799/timezone-webhook/internal"
+	"github.com/m198799/timezone-webhook/internal/inject"
+)
+
+// admitWorkload send deployment to webhook with operation and return it patched
+func admitWorkload(t *testing.T, handler *RequestsHandler, operation admission.Operation, document []byte) ([]byte, internal.Patches) {
+	req := &admission.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Kind: deploymentKind},
+		Operation: operation,
+		Namespace: "default",
+		Object:    runtime.RawExtension{Raw: document},
+	}
+	patches, _, err := handler.handleWorkloadAdmissionRequest(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("webhook failed: %v", err)
+	}
+	if len(patches) == 0 {
+		return document, patches
+	}
+	return applyDecisionPatches(t, document, patches), patches
+}
+
+// setWorkloadAnnotation set annotation on metadata of deployment document
+func setWorkloadAnnotation(t *testing.T, document []byte, key, value string) []byte {
+	deployment := &appsv1.Deployment{}
+	if err := json.Unmarshal(document, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[key] = value
+	data, err := json.Marshal(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// setTemplateAnnotation set annotation on pod template of deployment document
+func setTemplateAnnotation(t *testing.T, document []byte, key, value string) []byte {
+	deployment := decodeDeployment(t, document)
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[key] = value
+	data, err := json.Marshal(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodeDeployment decode document and fail the test on error
+func decodeDeployment(t *testing.T, document []byte) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{}
+	if err := json.Unmarshal(document, deployment); err != nil {
+		t.Fatal(err)
+	}
+	return deployment
+}
+
+// TestWorkloadUpdate check an unchanged injection is skipped and a changed one replaces the previous injection
+func TestWorkloadUpdate(t *testing.T) {
+	handler := NewRequestsHandler()
+	handler.HostPathNodeLabel = "tzdata"
+	document := decisionDocument(t, decisionDeployment, map[string]string{
+		internal.InjectionStrategyAnnotation: string(inject.HostPathInjectionStrategy),
+	}, nil)
+
+	created, _ := admitWorkload(t, &handler, admission.Create, document)
+	if spec := decodeDeployment(t, created).Spec.Template.Spec; spec.NodeSelector["tzdata"] != "true" {
+		t.Fatalf("expected node selector of hostPath strategy, got %v", spec.NodeSelector)
+	}
+
+	if _, patches := admitWorkload(t, &handler, admission.Update, created); len(patches) != 0 {
+		t.Fatalf("expected unchanged injection skipped, got %v", patches)
+	}
+
+	updated := setWorkloadAnnotation(t, created, internal.TimezoneAnnotation, "Europe/Paris")
+	rendered, _ := admitWorkload(t, &handler, admission.Update, updated)
+	spec := decodeDeployment(t, rendered).Spec.Template.Spec
+	if env := spec.Containers[0].Env; len(env) != 1 || env[0].Value != "Europe/Paris" {
+		t.Fatalf("expected TZ replaced by Europe/Paris, got %v", env)
+	}
+	if len(spec.Volumes) != 1 || len(spec.Containers[0].VolumeMounts) != 1 {
+		t.Fatalf("expected previous volumes replaced, got %v %v", spec.Volumes, spec.Containers[0].VolumeMounts)
+	}
+
+	switched := setWorkloadAnnotation(t, rendered, internal.InjectionStrategyAnnotation, string(inject.ConfigMapInjectionStrategy))
+	rendered, _ = admitWorkload(t, &handler, admission.Update, switched)
+	spec = decodeDeployment(t, rendered).Spec.Template.Spec
+	if spec.NodeSelector != nil {
+		t.Fatalf("expected node selector of hostPath strategy stripped, got %v", spec.NodeSelector)
+	}
+	if strategy := inject.InjectedStrategy(&spec); strategy != inject.ConfigMapInjectionStrategy {
+		t.Fatalf("expected configmap strategy, got %s", strategy)
+	}
+}
+
+// TestWorkloadUpdateTemplateAnnotation check injection does not write the timezone annotation, so an edit
+// of the template annotation or the default timezone is re-rendered instead of shadowed by the previous one
+func TestWorkloadUpdateTemplateAnnotation(t *testing.T) {
+	handler := NewRequestsHandler()
+	document := decisionDocument(t, decisionDeployment, nil, map[string]string{internal.TimezoneAnnotation: "Asia/Tokyo"})
+
+	created, _ := admitWorkload(t, &handler, admission.Create, document)
+	deployment := decodeDeployment(t, created)
+	if _, ok := deployment.Annotations[internal.TimezoneAnnotation]; ok {
+		t.Fatalf("expected timezone annotation not written on workload, got %v", deployment.Annotations)
+	}
+	if timezone := deployment.Spec.Template.Annotations[internal.InjectedTimezoneAnnotation]; timezone != "Asia/Tokyo" {
+		t.Fatalf("expected Asia/Tokyo recorded, got %q", timezone)
+	}
+
+	updated := setTemplateAnnotation(t, created, internal.TimezoneAnnotation, "Europe/Paris")
+	rendered, _ := admitWorkload(t, &handler, admission.Update, updated)
+	deployment = decodeDeployment(t, rendered)
+	if env := deployment.Spec.Template.Spec.Containers[0].Env; len(env) != 1 || env[0].Value != "Europe/Paris" {
+		t.Fatalf("expected TZ replaced by Europe/Paris, got %v", env)
+	}
+	if timezone := deployment.Spec.Template.Annotations[internal.TimezoneAnnotation]; timezone != "Europe/Paris" {
+		t.Fatalf("expected template annotation kept as Europe/Paris, got %q", timezone)
+	}
+
+	unset := decodeDeployment(t, rendered)
+	delete(unset.Spec.Template.Annotations, internal.TimezoneAnnotation)
+	document, err := json.Marshal(unset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.DefaultTimezone = "UTC"
+	rendered, _ = admitWorkload(t, &handler, admission.Update, document)
+	if env := decodeDeployment(t, rendered).Spec.Template.Spec.Containers[0].Env; len(env) != 1 || env[0].Value != "UTC" {
+		t.Fatalf("expected TZ replaced by default timezone UTC, got %v", env)
+	}
+}
+
+// TestWorkloadUpdateContainerNotInjected check re-render keep TZ of a container added after injection,
+// only the env vars recorded by injection are replaced
+func TestWorkloadUpdateContainerNotInjected(t *testing.T) {
+	handler := NewRequestsHandler()
+	created, _ := admitWorkload(t, &handler, admission.Create, decisionDocument(t, decisionDeployment, nil, nil))
+
+	deployment := decodeDeployment(t, created)
+	deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, corev1.Container{
+		Name: "debug", Image: "debug", Env: []corev1.EnvVar{{Name: inject.TZEnvName, Value: "UTC"}},
+	})
+	deployment.Annotations = map[string]string{internal.TimezoneAnnotation: "Europe/Paris"}
+	document, err := json.Marshal(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, _ := admitWorkload(t, &handler, admission.Update, document)
+	containers := decodeDeployment(t, rendered).Spec.Template.Spec.Containers
+	if env := containers[0].Env; len(env) != 1 || env[0].Value != "Europe/Paris" {
+		t.Fatalf("expected TZ of app replaced by Europe/Paris, got %v", env)
+	}
+	expected := []corev1.EnvVar{{Name: inject.TZEnvName, Value: "UTC"}, {Name: inject.TZEnvName, Value: "Europe/Paris"}}
+	if env := containers[1].Env; !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected TZ of debug kept before the injected one %v, got %v", expected, env)
+	}
+}
+
+const javaDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: app
+        env:
+        - name: JAVA_TOOL_OPTIONS
+          value: -Xmx1g
+`
+
+// TestWorkloadUpdateEnvTemplates check re-render replaces the env vars of env templates instead of appending
+// them again, and removes them when env templates are disabled
+func TestWorkloadUpdateEnvTemplates(t *testing.T) {
+	handler := NewRequestsHandler()
+	handler.EnvTemplateNames = []string{"java", "locale"}
+	document := decisionDocument(t, javaDeployment, nil, nil)
+
+	created, _ := admitWorkload(t, &handler, admission.Create, document)
+	updated := setWorkloadAnnotation(t, created, internal.TimezoneAnnotation, "Europe/Paris")
+	rendered, _ := admitWorkload(t, &handler, admission.Update, updated)
+	expected := []corev1.EnvVar{
+		{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx1g -Duser.timezone=Europe/Paris"},
+		{Name: inject.TZEnvName, Value: "Europe/Paris"},
+		{Name: "LC_TIME", Value: "C.UTF-8"},
+	}
+	if env := decodeDeployment(t, rendered).Spec.Template.Spec.Containers[0].Env; !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected env %v, got %v", expected, env)
+	}
+
+	disabled := setWorkloadAnnotation(t, rendered, internal.EnvTemplatesAnnotation, inject.NoEnvTemplates)
+	disabled = setWorkloadAnnotation(t, disabled, internal.TimezoneAnnotation, "UTC")
+	rendered, _ = admitWorkload(t, &handler, admission.Update, disabled)
+	deployment := decodeDeployment(t, rendered)
+	expected = []corev1.EnvVar{
+		{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx1g"},
+		{Name: inject.TZEnvName, Value: "UTC"},
+	}
+	if env := deployment.Spec.Template.Spec.Containers[0].Env; !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected env %v, got %v", expected, env)
+	}
+	if record := deployment.Spec.Template.Annotations[internal.InjectedEnvAnnotation]; record != `{"app":[{"name":"TZ","added":true}]}` {
+		t.Fatalf("expected record of env templates removed, got %s", record)
+	}
+}
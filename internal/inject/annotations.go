@@ -0,0 +1,208 @@
+package inject
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+const injectFalse = "false"
+
+// AnnotatedGenerator is PatchGenerator honoring the annotations the webhook honors,
+// settings of PatchGenerator are used when objects and namespace do not set them.
+// It is the decision engine shared by the webhook and the inject command
+type AnnotatedGenerator struct {
+	PatchGenerator
+	// InjectByDefault inject objects when neither object nor namespace set inject annotation
+	InjectByDefault bool
+	// EnvTemplateNames select env templates when neither object nor namespace set env templates annotation
+	EnvTemplateNames []string
+	// EnvTemplates are the known env templates, DefaultEnvTemplates if nil
+	EnvTemplates EnvTemplates
+	// RegionTimezones map region or zone to timezone, e.g. us-east-1=America/New_York
+	RegionTimezones map[string]string
+	// LabelTimezones set the timezone of pods by labels, the first matching rule wins
+	LabelTimezones []LabelTimezone
+}
+
+// Decision is the result of resolving annotations of an object
+type Decision struct {
+	// Generator generate patches for the object, nil if the object should not be injected
+	Generator *PatchGenerator
+	// Reason explain why the object is not injected
+	Reason string
+	// Warnings for deprecated or suspicious timezone
+	Warnings []string
+	// Rules are the annotations consulted in order and the source that won
+	Rules []Rule
+}
+
+// Source is where the value of a rule comes from
+type Source string
+
+const (
+	// ObjectSource is an annotation of the object or its pod template
+	ObjectSource Source = "object"
+	// NamespaceSource is an annotation of the namespace
+	NamespaceSource Source = "namespace"
+	// DefaultSource is the default setting of webhook or command
+	DefaultSource Source = "default"
+	// NoSource is an annotation not set anywhere
+	NoSource Source = "-"
+)
+
+// Rule is an annotation consulted by Decide
+type Rule struct {
+	Name   string
+	Source Source
+	Value  string
+}
+
+// Generate return no patches for objects which are injected or not requested to inject
+func (g *AnnotatedGenerator) Generate(ctx context.Context, object interface{}, pathPrefix string) (internal.Patches, error) {
+	var (
+		annotations map[string]string
+		podLabels   map[string]string
+		spec        *corev1.PodSpec
+	)
+	switch o := object.(type) {
+	case *appsv1.StatefulSet:
+		annotations, podLabels, spec = MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.Spec.Template.Labels, &o.Spec.Template.Spec
+	case *appsv1.Deployment:
+		annotations, podLabels, spec = MergeAnnotations(o.Spec.Template.Annotations, o.Annotations), o.Spec.Template.Labels, &o.Spec.Template.Spec
+	case *corev1.Pod:
+		annotations, podLabels, spec = o.Annotations, o.Labels, &o.Spec
+	case *corev1.List:
+		return generateList(ctx, g, o, pathPrefix)
+	default:
+		return make(internal.Patches, 0), fmt.Errorf("not injectable object: %T", object)
+	}
+
+	decision := g.Decide(annotations, nil, podLabels, spec)
+	if decision.Generator == nil {
+		return internal.Patches{}, nil
+	}
+	return decision.Generator.Generate(ctx, object, pathPrefix)
+}
+
+// Decide resolve annotations of object, first from object, second from namespace, three from default value,
+// podLabels are matched by label rules and spec is consulted for the region or zone pod is pinned to
+func (g *AnnotatedGenerator) Decide(annotations, namespaceAnnotations, podLabels map[string]string, spec *corev1.PodSpec) Decision {
+	var decision Decision
+	annotations, namespaceAnnotations = internal.NormalizeAnnotations(annotations), internal.NormalizeAnnotations(namespaceAnnotations)
+	if value, ok := annotations[internal.InjectedAnnotation]; ok {
+		decision.rule(internal.InjectedAnnotation, ObjectSource, value)
+		decision.Reason = "it is already injected"
+		return decision
+	}
+	decision.rule(internal.InjectedAnnotation, NoSource, "")
+
+	isInject, source := lookupAnnotation(internal.InjectAnnotation, annotations, namespaceAnnotations)
+	if source == NoSource {
+		isInject, source = fmt.Sprintf("%t", g.InjectByDefault), DefaultSource
+	}
+	decision.rule(internal.InjectAnnotation, source, isInject)
+	if isInject == injectFalse {
+		decision.Reason = fmt.Sprintf("annotation on %s is explicitly false for injection", source)
+		if source == DefaultSource {
+			decision.Reason = "no other instruction and injection disabled by default"
+		}
+		return decision
+	}
+
+	generator := g.PatchGenerator
+	generator.Timezone = g.resolveTimezone(&decision, annotations, namespaceAnnotations, podLabels, spec)
+	strategy, source := lookupAnnotation(internal.InjectionStrategyAnnotation, annotations, namespaceAnnotations)
+	if source != NoSource {
+		generator.Strategy = InjectionStrategy(strategy)
+	} else {
+		source = DefaultSource
+	}
+	decision.rule(internal.InjectionStrategyAnnotation, source, string(generator.Strategy))
+
+	names, source := lookupAnnotation(internal.EnvTemplatesAnnotation, annotations, namespaceAnnotations)
+	if source == NoSource {
+		names, source = strings.Join(g.EnvTemplateNames, ","), DefaultSource
+	}
+	decision.rule(internal.EnvTemplatesAnnotation, source, names)
+	templates := g.EnvTemplates
+	if templates == nil {
+		templates = DefaultEnvTemplates
+	}
+	var warnings []string
+	generator.Env, warnings = templates.Resolve(strings.Split(names, ","))
+	decision.Warnings = append(decision.Warnings, warnings...)
+
+	decision.Warnings = append(decision.Warnings, TimezoneWarnings(generator.Timezone)...)
+	generator.ContainerTimezones = map[string]string{}
+	for _, key := range containerTimezoneKeys(annotations, namespaceAnnotations) {
+		timezone, source := lookupAnnotation(key, annotations, namespaceAnnotations)
+		decision.rule(key, source, timezone)
+
+		generator.ContainerTimezones[strings.TrimPrefix(key, internal.ContainerTimezoneAnnotationPrefix)] = timezone
+		decision.Warnings = append(decision.Warnings, TimezoneWarnings(timezone)...)
+	}
+	decision.Generator = &generator
+	return decision
+}
+
+// rule record a rule consulted by Decide
+func (d *Decision) rule(name string, source Source, value string) {
+	d.Rules = append(d.Rules, Rule{Name: name, Source: source, Value: value})
+}
+
+// lookupAnnotation return the value of key from object or namespace annotations and where it was found
+func lookupAnnotation(key string, annotations, namespaceAnnotations map[string]string) (string, Source) {
+	if value, ok := annotations[key]; ok {
+		return value, ObjectSource
+	} else if value, ok = namespaceAnnotations[key]; ok {
+		return value, NamespaceSource
+	}
+	return "", NoSource
+}
+
+// TimezoneWarnings return the warnings which should be shown to user for a deprecated tzdata link or
+// a legacy abbreviation, the timezone is injected as it is
+func TimezoneWarnings(timezone string) []string {
+	var warnings []string
+	if canonical, ok := CanonicalTimezone(timezone); ok {
+		warnings = append(warnings, fmt.Sprintf("timezone %q is a deprecated alias of %q and may be missing from tzdata of newer images; please update the %s annotation", timezone, canonical, internal.TimezoneAnnotation))
+	}
+	if suggestion, ok := LegacyAbbreviation(timezone); ok {
+		warnings = append(warnings, fmt.Sprintf("timezone %q is a legacy abbreviation and may not mean what you expect, consider %s", timezone, suggestion))
+	}
+	return warnings
+}
+
+// containerTimezoneKeys return the sorted per-container timezone annotation keys of object and namespace
+func containerTimezoneKeys(annotations ...map[string]string) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, m := range annotations {
+		for key := range m {
+			if strings.HasPrefix(key, internal.ContainerTimezoneAnnotationPrefix) && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MergeAnnotations merge annotations in order, later ones win
+func MergeAnnotations(annotations ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range annotations {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,76 @@
+package inject
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// TestDecideWarnings check the warnings of every step of Decide are returned together
+func TestDecideWarnings(t *testing.T) {
+	cases := []struct {
+		name         string
+		annotations  map[string]string
+		nodeSelector map[string]string
+		expected     []string
+	}{
+		{name: "region without timezone", annotations: map[string]string{internal.RegionAnnotation: "eu-west-1"},
+			expected: []string{`region "eu-west-1" of object has no timezone in region map`}},
+		{name: "pinned zone without timezone", nodeSelector: map[string]string{corev1.LabelTopologyZone: "eu-west-1a"},
+			expected: []string{"pod is pinned to " + corev1.LabelTopologyZone + "=eu-west-1a which has no timezone in region map"}},
+		{name: "region and env template", annotations: map[string]string{internal.RegionAnnotation: "eu-west-1", internal.EnvTemplatesAnnotation: "java,python"},
+			expected: []string{`region "eu-west-1" of object has no timezone in region map`, `unknown env template "python", known templates: java,locale`}},
+		{name: "region and deprecated timezone", annotations: map[string]string{internal.RegionAnnotation: "us-east-1"},
+			expected: []string{`timezone "Asia/Calcutta" is a deprecated alias of "Asia/Kolkata" and may be missing from tzdata of newer images; please update the ` + internal.TimezoneAnnotation + " annotation"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true, RegionTimezones: map[string]string{"us-east-1": "Asia/Calcutta"}}
+			decision := g.Decide(c.annotations, nil, nil, &corev1.PodSpec{NodeSelector: c.nodeSelector})
+			if decision.Generator == nil {
+				t.Fatalf("expected injected: %s", decision.Reason)
+			}
+			if !reflect.DeepEqual(decision.Warnings, c.expected) {
+				t.Fatalf("expected warnings %q, got %q", c.expected, decision.Warnings)
+			}
+		})
+	}
+}
+
+// TestTimezoneWarnings check deprecated aliases and legacy abbreviations are warned about and still injected
+// as they are requested
+func TestTimezoneWarnings(t *testing.T) {
+	cases := []struct {
+		timezone string
+		expected []string
+	}{
+		{timezone: "Asia/Shanghai"},
+		{timezone: "Asia/Calcutta", expected: []string{`timezone "Asia/Calcutta" is a deprecated alias of "Asia/Kolkata" and may be missing from tzdata of newer images; please update the ` + internal.TimezoneAnnotation + " annotation"}},
+		{timezone: "CST", expected: []string{`timezone "CST" is a legacy abbreviation and may not mean what you expect, consider America/Chicago or Asia/Shanghai`}},
+		{timezone: "EST", expected: []string{`timezone "EST" is a legacy abbreviation and may not mean what you expect, consider America/New_York`}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.timezone, func(t *testing.T) {
+			if warnings := TimezoneWarnings(c.timezone); !reflect.DeepEqual(warnings, c.expected) {
+				t.Fatalf("expected warnings %q, got %q", c.expected, warnings)
+			}
+
+			g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+			decision := g.Decide(map[string]string{internal.TimezoneAnnotation: c.timezone, internal.ContainerTimezoneAnnotationPrefix + "app": c.timezone}, nil, nil, &corev1.PodSpec{})
+			if decision.Generator == nil {
+				t.Fatalf("expected injected: %s", decision.Reason)
+			}
+			if decision.Generator.Timezone != c.timezone || decision.Generator.TimezoneFor("app") != c.timezone {
+				t.Fatalf("expected %s injected as requested, got %s and %s", c.timezone, decision.Generator.Timezone, decision.Generator.TimezoneFor("app"))
+			}
+			if len(decision.Warnings) != 2*len(c.expected) {
+				t.Fatalf("expected warnings of pod and container timezone, got %q", decision.Warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package inject
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// EnvMerge is how an env template is merged into an env var which already exists
+type EnvMerge string
+
+const (
+	// AppendEnvMerge append value to the existing value separated by a space, words set by user
+	// are kept and the appended one wins as the last, e.g. -Duser.timezone of JAVA_TOOL_OPTIONS
+	AppendEnvMerge EnvMerge = "append"
+	// KeepEnvMerge keep the existing value, the template is only set when env var does not exist
+	KeepEnvMerge EnvMerge = "keep"
+	// ReplaceEnvMerge replace the existing value
+	ReplaceEnvMerge EnvMerge = "replace"
+
+	// TimezonePlaceholder in template value is replaced with the timezone of container
+	TimezonePlaceholder = "$TZ"
+	// NoEnvTemplates disable env templates in annotation
+	NoEnvTemplates = "none"
+)
+
+// EnvTemplate is an env var injected besides TZ, empty merge is the same as keep
+type EnvTemplate struct {
+	Name  string   `json:"name"`
+	Value string   `json:"value"`
+	Merge EnvMerge `json:"merge,omitempty"`
+}
+
+// injectedEnv record how injection changed an env var of a container, TZ or env template, so it could be stripped
+type injectedEnv struct {
+	Name string `json:"name"`
+	// Added is true when the env var did not exist before injection
+	Added bool `json:"added,omitempty"`
+	// Appended is the value appended to the existing value
+	Appended string `json:"appended,omitempty"`
+	// Replaced is the value before injection replaced it
+	Replaced *string `json:"replaced,omitempty"`
+}
+
+// injectedEnvs are the env vars changed by injection per container name, a container
+// which is not injected, e.g. added to pod template later, is not recorded
+type injectedEnvs map[string][]injectedEnv
+
+// added report whether env var name was added to container by injection
+func (e injectedEnvs) added(container, name string) bool {
+	for _, env := range e[container] {
+		if env.Name == name && env.Added {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInjectedEnvs read the env vars recorded in InjectedEnvAnnotation, nil when annotation is missing,
+// nothing is recorded when it is invalid
+func parseInjectedEnvs(annotations map[string]string) injectedEnvs {
+	value, ok := internal.LookupAnnotation(annotations, internal.InjectedEnvAnnotation)
+	if !ok {
+		return nil
+	}
+	envs := injectedEnvs{}
+	_ = json.Unmarshal([]byte(value), &envs)
+	return envs
+}
+
+// legacyInjectedEnvs is the record of an injection before InjectedEnvAnnotation was written, which
+// appended TZ to every container
+func legacyInjectedEnvs(spec *corev1.PodSpec) injectedEnvs {
+	envs := injectedEnvs{}
+	for _, c := range spec.Containers {
+		for _, env := range c.Env {
+			if env.Name == TZEnvName {
+				envs[c.Name] = []injectedEnv{{Name: TZEnvName, Added: true}}
+			}
+		}
+	}
+	return envs
+}
+
+// EnvTemplates are env templates by name, e.g. per language runtime
+type EnvTemplates map[string][]EnvTemplate
+
+// DefaultEnvTemplates are the built-in env templates
+var DefaultEnvTemplates = EnvTemplates{
+	"java": {
+		{Name: "JAVA_TOOL_OPTIONS", Value: "-Duser.timezone=" + TimezonePlaceholder, Merge: AppendEnvMerge},
+	},
+	"locale": {
+		{Name: "LC_TIME", Value: "C.UTF-8", Merge: KeepEnvMerge},
+	},
+}
+
+// LoadEnvTemplates return DefaultEnvTemplates with the templates of yaml or json file added,
+// templates in file replace the built-in ones with the same name
+func LoadEnvTemplates(path string) (EnvTemplates, error) {
+	templates := EnvTemplates{}
+	for name, envs := range DefaultEnvTemplates {
+		templates[name] = envs
+	}
+	if path == "" {
+		return templates, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env templates file %s, error: %w", path, err)
+	}
+	loaded := EnvTemplates{}
+	if err = yamlconvert.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to read env templates file %s, error: %w", path, err)
+	}
+	for name, envs := range loaded {
+		for _, env := range envs {
+			if env.Name == "" {
+				return nil, fmt.Errorf("env template %s has an env var without name", name)
+			}
+			switch env.Merge {
+			case "", AppendEnvMerge, KeepEnvMerge, ReplaceEnvMerge:
+			default:
+				return nil, fmt.Errorf("env template %s has unknown merge %q of %s", name, env.Merge, env.Name)
+			}
+		}
+		templates[name] = envs
+	}
+	return templates, nil
+}
+
+// Resolve return the env templates of names in order, a duplicate name is resolved once,
+// unknown names are returned as warnings
+func (t EnvTemplates) Resolve(names []string) ([]EnvTemplate, []string) {
+	var (
+		envs     []EnvTemplate
+		warnings []string
+		seen     = map[string]bool{}
+	)
+	for _, name := range names {
+		if name == "" || name == NoEnvTemplates || seen[name] {
+			continue
+		}
+		seen[name] = true
+		templates, ok := t[name]
+		if !ok {
+			known := make([]string, 0, len(t))
+			for k := range t {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			warnings = append(warnings, fmt.Sprintf("unknown env template %q, known templates: %s", name, strings.Join(known, ",")))
+			continue
+		}
+		envs = append(envs, templates...)
+	}
+	return envs, warnings
+}
+
+// createEnvTemplatePatches add or merge env templates into containers, container env is never empty
+// because TZ is added before. The changed env vars are recorded in envs
+func (g *PatchGenerator) createEnvTemplatePatches(spec *corev1.PodSpec, pathPrefix string, envs injectedEnvs) internal.Patches {
+	var patches = internal.Patches{}
+	for containerID, containerSpec := range spec.Containers {
+		timezone := g.TimezoneFor(containerSpec.Name)
+		for _, template := range g.Env {
+			value := strings.ReplaceAll(template.Value, TimezonePlaceholder, timezone)
+
+			index := -1
+			for i, env := range containerSpec.Env {
+				if env.Name == template.Name {
+					index = i
+				}
+			}
+			if index < 0 {
+				patches = append(patches, internal.Patch{
+					Op:    "add",
+					Path:  fmt.Sprintf("%s/containers/%d/env/-", pathPrefix, containerID),
+					Value: corev1.EnvVar{Name: template.Name, Value: value},
+				})
+				envs[containerSpec.Name] = append(envs[containerSpec.Name], injectedEnv{Name: template.Name, Added: true})
+				continue
+			}
+
+			existing := containerSpec.Env[index]
+			if existing.ValueFrom != nil || template.Merge == KeepEnvMerge || template.Merge == "" {
+				continue
+			}
+			recorded := injectedEnv{Name: template.Name, Replaced: &existing.Value}
+			if template.Merge == AppendEnvMerge {
+				recorded = injectedEnv{Name: template.Name, Appended: value}
+				value = appendEnvValue(existing.Value, template.Value, value)
+			}
+			if value == existing.Value {
+				continue
+			}
+			patches = append(patches, internal.Patch{
+				Op:    "replace",
+				Path:  fmt.Sprintf("%s/containers/%d/env/%d/value", pathPrefix, containerID, index),
+				Value: value,
+			})
+			envs[containerSpec.Name] = append(envs[containerSpec.Name], recorded)
+		}
+	}
+	return patches
+}
+
+// appendEnvValue append value to existing, the words of existing are kept so the value set by user
+// is restored on strip. Nothing is appended when the last word rendered from template is value
+func appendEnvValue(existing, template, value string) string {
+	prefix := template
+	if i := strings.Index(template, TimezonePlaceholder); i >= 0 {
+		prefix = template[:i]
+	}
+
+	words := strings.Fields(existing)
+	for i := len(words) - 1; i >= 0; i-- {
+		if prefix != "" && strings.HasPrefix(words[i], prefix) {
+			if words[i] == value {
+				return existing
+			}
+			break
+		}
+	}
+	return strings.Join(append(words, value), " ")
+}
+
+// removeEnvWord remove the last word of value which is the same as word
+func removeEnvWord(value, word string) string {
+	words := strings.Fields(value)
+	for i := len(words) - 1; i >= 0; i-- {
+		if words[i] == word {
+			return strings.Join(append(words[:i], words[i+1:]...), " ")
+		}
+	}
+	return value
+}
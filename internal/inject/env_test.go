@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const userTimezoneDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: app
+        env:
+        - name: JAVA_TOOL_OPTIONS
+          value: -Duser.timezone=UTC -Xmx1g
+`
+
+// TestAppendEnvKeepsUserWord check the java template is appended after -Duser.timezone set by user,
+// which is restored by uninject
+func TestAppendEnvKeepsUserWord(t *testing.T) {
+	injector := &AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true, EnvTemplateNames: []string{"java"}}
+	injected := applyGenerator(t, injector, userTimezoneDeployment)
+	if expected := `"value":"-Duser.timezone=UTC -Xmx1g -Duser.timezone=Asia/Shanghai"`; !strings.Contains(injected, expected) {
+		t.Fatalf("expected %s, got %s", expected, injected)
+	}
+	if stripped := applyGenerator(t, &Uninjector{}, injected); stripped != documentJSON(t, userTimezoneDeployment) {
+		t.Fatalf("expected uninject restore the value set by user\nexpected: %s\ngot:      %s", documentJSON(t, userTimezoneDeployment), stripped)
+	}
+}
+
+// TestResolveDuplicateEnvTemplates check a template named twice is injected once
+func TestResolveDuplicateEnvTemplates(t *testing.T) {
+	envs, warnings := DefaultEnvTemplates.Resolve([]string{"java", "locale", "java"})
+	if len(envs) != 2 || len(warnings) != 0 {
+		t.Fatalf("expected java and locale resolved once, got %v %v", envs, warnings)
+	}
+
+	injector := &AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true, EnvTemplateNames: []string{"java", "java"}}
+	injected := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(applyGenerator(t, injector, plainPod)), &injected); err != nil {
+		t.Fatal(err)
+	}
+	env := injected["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})["env"].([]interface{})
+	if len(env) != 2 {
+		t.Fatalf("expected TZ and JAVA_TOOL_OPTIONS, got %v", env)
+	}
+}
@@ -0,0 +1,175 @@
+package inject
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+const (
+	// HostPathTreeVolumeName is the volume of zoneinfo tree on node
+	HostPathTreeVolumeName = HostPathVolumeName + "-tree"
+
+	// zonePlaceholder and namePlaceholder are replaced in HostPathLayout with zone, e.g. Asia/Shanghai,
+	// and the base name of zone, e.g. Shanghai
+	zonePlaceholder = "{zone}"
+	namePlaceholder = "{name}"
+	// defaultNodeLabelValue is the value of HostPathNodeLabel without value
+	defaultNodeLabelValue = "true"
+)
+
+// createHostPathPatches mount the TZif file of every zone injected into pod as a HostPathFile volume,
+// so only the requested zones of node are exposed and pods fail clearly on nodes without them.
+// The zoneinfo tree is mounted as a HostPathDirectory volume only for ZoneInfoPath or directory layout
+func (g *PatchGenerator) createHostPathPatches(spec *corev1.PodSpec, pathPrefix string) internal.Patches {
+	var patches = internal.Patches{}
+	if len(spec.Containers) == 0 {
+		return patches
+	}
+	var (
+		zones    = hostPathZones(g, spec)                                     // zones of containers, sorted
+		mount    = g.layout() != DirectoryMountLayout                         // mount TZif file at LocalTimePath
+		tree     = g.layout() == DirectoryMountLayout || g.ZoneInfoPath != "" // mount zoneinfo tree
+		fileType = corev1.HostPathFile
+		dirType  = corev1.HostPathDirectory
+	)
+
+	if len(spec.Volumes) == 0 {
+		patches = append(patches, internal.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/volumes", pathPrefix),
+			Value: []corev1.Volume{},
+		})
+	}
+	for i, zone := range zones {
+		if !mount {
+			break
+		}
+		patches = append(patches, internal.Patch{
+			Op:   "add",
+			Path: fmt.Sprintf("%s/volumes/-", pathPrefix),
+			Value: corev1.Volume{
+				Name: hostPathVolumeName(i),
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: g.hostPathFor(zone), Type: &fileType},
+				},
+			},
+		})
+	}
+	if tree {
+		patches = append(patches, internal.Patch{
+			Op:   "add",
+			Path: fmt.Sprintf("%s/volumes/-", pathPrefix),
+			Value: corev1.Volume{
+				Name: HostPathTreeVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: g.HostPathPrefix, Type: &dirType},
+				},
+			},
+		})
+	}
+
+	for containerID, c := range spec.Containers {
+		if len(c.VolumeMounts) == 0 {
+			patches = append(patches, internal.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathPrefix, containerID),
+				Value: []corev1.VolumeMount{},
+			})
+		}
+		if mount {
+			patches = append(patches, internal.Patch{
+				Op:   "add",
+				Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
+				Value: corev1.VolumeMount{
+					Name:      hostPathVolumeName(sort.SearchStrings(zones, g.TimezoneFor(c.Name))),
+					ReadOnly:  true,
+					MountPath: g.LocalTimePath,
+				},
+			})
+		}
+		if tree {
+			patches = append(patches, internal.Patch{
+				Op:   "add",
+				Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
+				Value: corev1.VolumeMount{
+					Name:      HostPathTreeVolumeName,
+					ReadOnly:  true,
+					MountPath: g.hostPathZoneInfoPath(),
+				},
+			})
+		}
+	}
+
+	return append(patches, g.createNodeSelectorPatches(spec, pathPrefix)...)
+}
+
+// createNodeSelectorPatches only schedule pod to nodes with HostPathNodeLabel
+func (g *PatchGenerator) createNodeSelectorPatches(spec *corev1.PodSpec, pathPrefix string) internal.Patches {
+	var patches = internal.Patches{}
+	key, value := ParseNodeLabel(g.HostPathNodeLabel)
+	if key == "" {
+		return patches
+	}
+
+	if len(spec.NodeSelector) == 0 {
+		patches = append(patches, internal.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/nodeSelector", pathPrefix),
+			Value: map[string]string{},
+		})
+	}
+	return append(patches, internal.Patch{
+		Op:    "add",
+		Path:  fmt.Sprintf("%s/nodeSelector/%s", pathPrefix, escapeJSONPointer(key)),
+		Value: value,
+	})
+}
+
+// hostPathFor return the node path of TZif file of zone
+func (g *PatchGenerator) hostPathFor(zone string) string {
+	if g.HostPathLayout == "" {
+		return path.Join(g.HostPathPrefix, zone)
+	}
+	return strings.NewReplacer(zonePlaceholder, zone, namePlaceholder, path.Base(zone)).Replace(g.HostPathLayout)
+}
+
+// ParseNodeLabel split key=value of a node label, value is true if not specified
+func ParseNodeLabel(label string) (string, string) {
+	if label == "" {
+		return "", ""
+	}
+	if i := strings.Index(label, "="); i >= 0 {
+		return label[:i], label[i+1:]
+	}
+	return label, defaultNodeLabelValue
+}
+
+// hostPathZones return the sorted zones of containers
+func hostPathZones(g *PatchGenerator, spec *corev1.PodSpec) []string {
+	seen := map[string]bool{}
+	var zones []string
+	for _, c := range spec.Containers {
+		if zone := g.TimezoneFor(c.Name); !seen[zone] {
+			seen[zone] = true
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// hostPathVolumeName return the volume name of the i-th zone
+func hostPathVolumeName(i int) string {
+	return fmt.Sprintf("%s-%d", HostPathVolumeName, i)
+}
+
+// isHostPathVolume report whether name is a volume of hostPath strategy
+func isHostPathVolume(name string) bool {
+	return name == LegacyHostPathVolumeName || strings.HasPrefix(name, HostPathVolumeName+"-")
+}
@@ -0,0 +1,112 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestHostPathZones check every zone of pod is mounted from its own HostPathFile volume
+func TestHostPathZones(t *testing.T) {
+	cases := []struct {
+		name         string
+		layout       string
+		zoneInfoPath string
+		// volumes are the expected host paths by volume name, mounts the expected volumes by container
+		volumes map[string]string
+		mounts  map[string][]string
+	}{
+		{name: "zones",
+			volumes: map[string]string{"zoneinfo-hostpath-0": "/usr/share/zoneinfo/Asia/Shanghai", "zoneinfo-hostpath-1": "/usr/share/zoneinfo/UTC"},
+			mounts:  map[string][]string{"app": {"zoneinfo-hostpath-0"}, "worker": {"zoneinfo-hostpath-0"}, "istio-proxy": {"zoneinfo-hostpath-1"}}},
+		{name: "layout", layout: "/opt/tzdata/{name}",
+			volumes: map[string]string{"zoneinfo-hostpath-0": "/opt/tzdata/Shanghai", "zoneinfo-hostpath-1": "/opt/tzdata/UTC"},
+			mounts:  map[string][]string{"app": {"zoneinfo-hostpath-0"}, "worker": {"zoneinfo-hostpath-0"}, "istio-proxy": {"zoneinfo-hostpath-1"}}},
+		{name: "zoneinfo tree", zoneInfoPath: "/usr/share/zoneinfo",
+			volumes: map[string]string{"zoneinfo-hostpath-0": "/usr/share/zoneinfo/Asia/Shanghai", "zoneinfo-hostpath-1": "/usr/share/zoneinfo/UTC", HostPathTreeVolumeName: "/usr/share/zoneinfo"},
+			mounts: map[string][]string{"app": {"zoneinfo-hostpath-0", HostPathTreeVolumeName}, "worker": {"zoneinfo-hostpath-0", HostPathTreeVolumeName},
+				"istio-proxy": {"zoneinfo-hostpath-1", HostPathTreeVolumeName}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy, g.HostPathLayout, g.ZoneInfoPath = HostPathInjectionStrategy, c.layout, c.zoneInfoPath
+			g.ContainerTimezones = map[string]string{"istio-proxy": "UTC"}
+			pod := injectPod(t, g, "app", "worker", "istio-proxy")
+
+			volumes := map[string]string{}
+			for _, v := range pod.Spec.Volumes {
+				expectedType := corev1.HostPathFile
+				if v.Name == HostPathTreeVolumeName {
+					expectedType = corev1.HostPathDirectory
+				}
+				if v.HostPath == nil || v.HostPath.Type == nil || *v.HostPath.Type != expectedType {
+					t.Fatalf("expected %s volume %s, got %+v", expectedType, v.Name, v.VolumeSource)
+				}
+				volumes[v.Name] = v.HostPath.Path
+			}
+			if !reflect.DeepEqual(volumes, c.volumes) {
+				t.Fatalf("expected volumes %v, got %v", c.volumes, volumes)
+			}
+
+			mounts := map[string][]string{}
+			for _, container := range pod.Spec.Containers {
+				for _, m := range container.VolumeMounts {
+					mounts[container.Name] = append(mounts[container.Name], m.Name)
+				}
+			}
+			if !reflect.DeepEqual(mounts, c.mounts) {
+				t.Fatalf("expected mounts %v, got %v", c.mounts, mounts)
+			}
+		})
+	}
+}
+
+// TestHostPathNodeSelector check the node label is added to node selector and the existing ones are kept
+func TestHostPathNodeSelector(t *testing.T) {
+	cases := []struct {
+		name      string
+		nodeLabel string
+		existing  map[string]string
+		expected  map[string]string
+	}{
+		{name: "disabled"},
+		{name: "label without value", nodeLabel: "tzdata", expected: map[string]string{"tzdata": "true"}},
+		{name: "label with value", nodeLabel: "timezone.jugglechat.io/tzdata=2024a", expected: map[string]string{"timezone.jugglechat.io/tzdata": "2024a"}},
+		{name: "existing selector", nodeLabel: "tzdata", existing: map[string]string{"disk": "ssd"}, expected: map[string]string{"disk": "ssd", "tzdata": "true"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy, g.HostPathNodeLabel = HostPathInjectionStrategy, c.nodeLabel
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "app"},
+				Spec:       corev1.PodSpec{NodeSelector: c.existing, Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+			}
+			patches, err := g.Generate(context.TODO(), pod, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = applyPatches(data, patches); err != nil {
+				t.Fatal(err)
+			}
+			injected := &corev1.Pod{}
+			if err = json.Unmarshal(data, injected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(injected.Spec.NodeSelector, c.expected) {
+				t.Fatalf("expected node selector %v, got %v", c.expected, injected.Spec.NodeSelector)
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package inject
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -32,12 +34,24 @@ const (
 	// TZif files exists on the node machines, and we can just mount them
 	// with hostPath volumes
 	HostPathInjectionStrategy InjectionStrategy = "hostPath"
+
+	// HostPathVolumeName is the prefix of volume names of hostPath strategy
+	HostPathVolumeName = "zoneinfo-hostpath"
+	// LegacyHostPathVolumeName is the volume name of hostPath strategy before it was hardened
+	LegacyHostPathVolumeName = "webhook"
+	// TZEnvName is the env name injected into containers
+	TZEnvName = "TZ"
 )
 
 var (
 	jsonPointerEscapeReplacer = strings.NewReplacer("~", "~0", "/", "~1")
 )
 
+// Generator generate json patches for an injectable object
+type Generator interface {
+	Generate(ctx context.Context, object interface{}, pathPrefix string) (internal.Patches, error)
+}
+
 // PatchGenerator ...
 type PatchGenerator struct {
 	Strategy           InjectionStrategy
@@ -46,6 +60,25 @@ type PatchGenerator struct {
 	HostPathPrefix     string
 	LocalTimePath      string
 	ConfigMapName      string
+	// ContainerTimezones override Timezone for containers by name
+	ContainerTimezones map[string]string
+	// Env are injected into containers besides TZ
+	Env []EnvTemplate
+	// TimezoneFilePath mount a file containing the zone name, e.g. /etc/timezone, empty to disable
+	TimezoneFilePath string
+	// ZoneInfoPath mount the zoneinfo tree, empty to disable, hostPath strategy mount it at
+	// DefaultZoneInfoPath if empty
+	ZoneInfoPath string
+	// MountLayouts is the mount layout by strategy, DefaultMountLayout if not set
+	MountLayouts map[InjectionStrategy]MountLayout
+	// ZoneInfoMountDir is where configmap is mounted by DirectoryMountLayout
+	ZoneInfoMountDir string
+	// HostPathLayout is the node path of a TZif file with {zone} and {name} placeholders,
+	// e.g. /opt/tzdata/{name}, HostPathPrefix/{zone} if empty
+	HostPathLayout string
+	// HostPathNodeLabel only schedule pods of hostPath strategy to nodes with this label,
+	// e.g. timezone.jugglechat.io/tzdata=true, disabled if empty
+	HostPathNodeLabel string
 }
 
 // NewPatchGenerator ...
@@ -77,13 +110,22 @@ func (g *PatchGenerator) Generate(ctx context.Context, object interface{}, pathP
 			fmt.Sprintf("%s/metadata", pathPrefix): &o.ObjectMeta,
 		})
 	case *corev1.List:
-		return g.handleList(ctx, o, pathPrefix)
+		return generateList(ctx, g, o, pathPrefix)
 	}
 
 	return make(internal.Patches, 0), fmt.Errorf("not injectable object: %T", object)
 }
 
-func (g *PatchGenerator) handleList(ctx context.Context, list *corev1.List, pathPrefix string) (internal.Patches, error) {
+// TimezoneFor return the timezone injected into container
+func (g *PatchGenerator) TimezoneFor(container string) string {
+	if timezone, ok := g.ContainerTimezones[container]; ok {
+		return timezone
+	}
+	return g.Timezone
+}
+
+// generateList call generator for every item of list
+func generateList(ctx context.Context, g Generator, list *corev1.List, pathPrefix string) (internal.Patches, error) {
 	var (
 		err     error
 		patches internal.Patches
@@ -122,17 +164,25 @@ func (g *PatchGenerator) forPodSpec(spec *corev1.PodSpec, pathPrefix string, pos
 	} else {
 		return nil, fmt.Errorf("unknown injection strategy specified: %s", g.Strategy)
 	}
+	if layout := g.layout(); layout != SubPathMountLayout && layout != DirectoryMountLayout {
+		return nil, fmt.Errorf("unknown mount layout specified: %s", layout)
+	}
 
-	patches = append(patches, g.createEnvironmentVariablePatches(spec, pathPrefix)...)
+	patches = append(patches, g.createTimezoneFilePatches(spec, pathPrefix)...)
+	patches = append(patches, g.createZoneInfoTreePatches(spec, pathPrefix)...)
+	envs := injectedEnvs{}
+	patches = append(patches, g.createEnvironmentVariablePatches(spec, pathPrefix, envs)...)
+	patches = append(patches, g.createEnvTemplatePatches(spec, pathPrefix, envs)...)
 
 	for k, v := range postInjectionAnnotations {
-		patches = append(patches, g.createPostInjectionAnnotations(v, k)...)
+		patches = append(patches, g.createPostInjectionAnnotations(v, k, envs)...)
 	}
 
 	return patches, nil
 }
 
-func (g *PatchGenerator) createEnvironmentVariablePatches(spec *corev1.PodSpec, pathPrefix string) internal.Patches {
+// createEnvironmentVariablePatches append TZ to every container and record it in envs
+func (g *PatchGenerator) createEnvironmentVariablePatches(spec *corev1.PodSpec, pathPrefix string, envs injectedEnvs) internal.Patches {
 	var patches = internal.Patches{}
 	for containerID, containerSpec := range spec.Containers {
 		if len(containerSpec.Env) == 0 {
@@ -147,10 +197,11 @@ func (g *PatchGenerator) createEnvironmentVariablePatches(spec *corev1.PodSpec,
 			Op:   "add",
 			Path: fmt.Sprintf("%s/containers/%d/env/-", pathPrefix, containerID),
 			Value: corev1.EnvVar{
-				Name:  "TZ",
-				Value: g.Timezone,
+				Name:  TZEnvName,
+				Value: g.TZValueFor(containerSpec.Name),
 			},
 		})
+		envs[containerSpec.Name] = append(envs[containerSpec.Name], injectedEnv{Name: TZEnvName, Added: true})
 	}
 	return patches
 }
@@ -194,86 +245,40 @@ func (g *PatchGenerator) createConfigMapPatches(spec *corev1.PodSpec, pathPrefix
 				Value: []corev1.VolumeMount{},
 			})
 		}
-		_, timeZone := filepath.Split(g.Timezone)
-		log.Info(fmt.Sprintf("timeZone is %s,g.Timezone is %s", timeZone, g.Timezone))
-		patches = append(patches, internal.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
-			Value: corev1.VolumeMount{
-				Name:      DefaultVolumeName,
-				ReadOnly:  true,
-				MountPath: g.LocalTimePath,
-				SubPath:   timeZone,
-			},
-		})
-	}
-	// TODO initContainer zoneinfo
-	return patches
-}
-
-func (g *PatchGenerator) createHostPathPatches(spec *corev1.PodSpec, pathPrefix string) internal.Patches {
-	var patches = internal.Patches{}
-	containers := len(spec.Containers)
-	if containers == 0 {
-		return patches
-	}
-
-	for containerID := 0; containerID < containers; containerID++ {
-		if len(spec.Containers[containerID].VolumeMounts) == 0 {
+		if g.layout() == DirectoryMountLayout {
 			patches = append(patches, internal.Patch{
-				Op:    "add",
-				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathPrefix, containerID),
-				Value: []corev1.VolumeMount{},
+				Op:   "add",
+				Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
+				Value: corev1.VolumeMount{
+					Name:      DefaultVolumeName,
+					ReadOnly:  true,
+					MountPath: g.zoneInfoMountDir(),
+				},
 			})
+			continue
 		}
 
+		containerTimezone := g.TimezoneFor(spec.Containers[containerID].Name)
+		_, timeZone := filepath.Split(containerTimezone)
+		log.Info(fmt.Sprintf("timeZone is %s,g.Timezone is %s", timeZone, containerTimezone))
 		patches = append(patches, internal.Patch{
 			Op:   "add",
 			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
 			Value: corev1.VolumeMount{
-				Name:      "webhook",
+				Name:      DefaultVolumeName,
 				ReadOnly:  true,
 				MountPath: g.LocalTimePath,
-				SubPath:   g.Timezone,
-			},
-		})
-
-		patches = append(patches, internal.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
-			Value: corev1.VolumeMount{
-				Name:      "webhook",
-				ReadOnly:  true,
-				MountPath: DefaultHostPathPrefix,
+				SubPath:   timeZone,
 			},
 		})
 	}
-
-	if len(spec.Volumes) == 0 {
-		patches = append(patches, internal.Patch{
-			Op:    "add",
-			Path:  fmt.Sprintf("%s/volumes", pathPrefix),
-			Value: []corev1.Volume{},
-		})
-	}
-
-	patches = append(patches, internal.Patch{
-		Op:   "add",
-		Path: fmt.Sprintf("%s/volumes/-", pathPrefix),
-		Value: corev1.Volume{
-			Name: "webhook",
-			VolumeSource: corev1.VolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Path: g.HostPathPrefix,
-				},
-			},
-		},
-	})
-
+	// TODO initContainer zoneinfo
 	return patches
 }
 
-func (g *PatchGenerator) createPostInjectionAnnotations(meta *metav1.ObjectMeta, pathPrefix string) internal.Patches {
+// createPostInjectionAnnotations record the injection in meta, envs are the env vars changed by injection,
+// a record of previous injection is removed when no env var is changed
+func (g *PatchGenerator) createPostInjectionAnnotations(meta *metav1.ObjectMeta, pathPrefix string, envs injectedEnvs) internal.Patches {
 	var patches = internal.Patches{}
 	if len(meta.Annotations) == 0 {
 		patches = append(patches, internal.Patch{
@@ -288,15 +293,56 @@ func (g *PatchGenerator) createPostInjectionAnnotations(meta *metav1.ObjectMeta,
 		Path:  fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(internal.InjectedAnnotation)),
 		Value: "true",
 	})
+	// the injected timezone is recorded under its own keys, the timezone annotations are left to user
+	// so a later change of template, namespace or default is not shadowed by a previous injection
 	patches = append(patches, internal.Patch{
 		Op:    "add",
-		Path:  fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(internal.TimezoneAnnotation)),
+		Path:  fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(internal.InjectedTimezoneAnnotation)),
 		Value: g.Timezone,
 	})
+	for _, name := range sortedContainerNames(g.ContainerTimezones) {
+		patches = append(patches, internal.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(internal.InjectedContainerTimezoneAnnotationPrefix+name)),
+			Value: g.ContainerTimezones[name],
+		})
+	}
+	for _, key := range sortedAnnotationKeys(meta.Annotations) {
+		name := strings.TrimPrefix(key, internal.InjectedContainerTimezoneAnnotationPrefix)
+		if _, ok := g.ContainerTimezones[name]; name != key && !ok {
+			patches = append(patches, internal.Patch{
+				Op:   "remove",
+				Path: fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(key)),
+			})
+		}
+	}
 
+	if len(envs) > 0 {
+		data, _ := json.Marshal(envs) //nolint:errcheck
+		patches = append(patches, internal.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(internal.InjectedEnvAnnotation)),
+			Value: string(data),
+		})
+	} else if _, ok := meta.Annotations[internal.InjectedEnvAnnotation]; ok {
+		patches = append(patches, internal.Patch{
+			Op:   "remove",
+			Path: fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(internal.InjectedEnvAnnotation)),
+		})
+	}
 	return patches
 }
 
+// sortedAnnotationKeys return the keys of annotations in order so patches are stable
+func sortedAnnotationKeys(annotations map[string]string) []string {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func parseTypeMetaSkeleton(data []byte) (interface{}, error) {
 	var meta metav1.TypeMeta
 	err := yaml.Unmarshal(data, &meta)
@@ -317,6 +363,18 @@ func parseTypeMetaSkeleton(data []byte) (interface{}, error) {
 	return nil, nil
 }
 
+// DecodeObject decode an injectable object from yaml or json, nil if kind is not injectable
+func DecodeObject(data []byte) (interface{}, error) {
+	obj, err := parseTypeMetaSkeleton(data)
+	if err != nil || obj == nil {
+		return obj, err
+	}
+	if err = yaml.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
 func escapeJSONPointer(p string) string {
 	return jsonPointerEscapeReplacer.Replace(p)
 }
@@ -0,0 +1,144 @@
+package inject
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// supportedExtensions are the file extensions read when walking directories
+var supportedExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// InputOptions control how directories and globs are expanded to inputs
+type InputOptions struct {
+	// Recursive walk sub directories of directory arguments
+	Recursive bool
+	// Include only read files matching one of the globs, match relative path or file name
+	Include []string
+	// Exclude skip files matching one of the globs, match relative path or file name
+	Exclude []string
+}
+
+// CollectInputs convert arguments to inputs, "-" is standard input, directory and glob arguments
+// are expanded, files are opened when they are transformed
+func CollectInputs(args []string, opts InputOptions) (Inputs, error) {
+	inputs := Inputs{}
+	for i, arg := range args {
+		if arg == "-" {
+			inputs = append(inputs, Input{ArgNumber: i, Identifier: arg, Reader: os.Stdin})
+			continue
+		}
+
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob input(%d): %s, error: %w", i, arg, err)
+			} else if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches input(%d): %s", i, arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open input(%d): %s, error: %w", i, path, err)
+			}
+
+			if !info.IsDir() {
+				if opts.match(path, filepath.Base(path)) {
+					inputs = append(inputs, Input{ArgNumber: i, Identifier: path, RelativePath: relativeInputPath(path)})
+				}
+				continue
+			}
+
+			dirInputs, err := collectDirectory(i, path, opts)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, dirInputs...)
+		}
+	}
+
+	return inputs, nil
+}
+
+// collectDirectory return supported files in dir, RelativePath is relative to dir
+func collectDirectory(argNumber int, dir string, opts InputOptions) (Inputs, error) {
+	inputs := Inputs{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && !opts.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !supportedExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if opts.match(rel, entry.Name()) {
+			inputs = append(inputs, Input{ArgNumber: argNumber, Identifier: path, RelativePath: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk input(%d): %s, error: %w", argNumber, dir, err)
+	}
+	return inputs, nil
+}
+
+// match report whether a file is selected by Include and Exclude globs
+func (o InputOptions) match(rel, name string) bool {
+	matchAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, rel); ok { //nolint:errcheck
+				return true
+			}
+			if ok, _ := filepath.Match(pattern, name); ok { //nolint:errcheck
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(o.Include) > 0 && !matchAny(o.Include) {
+		return false
+	}
+	return !matchAny(o.Exclude)
+}
+
+// relativeInputPath keep relative paths inside working directory, others only keep file name
+func relativeInputPath(path string) string {
+	if clean := filepath.Clean(path); !filepath.IsAbs(clean) && !strings.HasPrefix(clean, "..") {
+		return clean
+	}
+	return filepath.Base(path)
+}
+
+// open return reader of input, files without Reader are opened
+func (i *Input) open() (io.ReadCloser, error) {
+	if i.Reader != nil {
+		return io.NopCloser(i.Reader), nil
+	}
+	file, err := os.Open(i.Identifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input(%d): %s, error: %w", i.ArgNumber, i.Identifier, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,97 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeInputTree create files under dir with the deployment as content
+func writeInputTree(t *testing.T, dir string, files ...string) {
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(namespacedDeployment), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCollectInputs check directories and globs are expanded to the expected relative paths
+func TestCollectInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeInputTree(t, dir, "app.yaml", "app.json", "README.md", "base/db.yml", "base/secret.yaml", "base/nested/job.yaml")
+
+	cases := []struct {
+		name     string
+		args     []string
+		opts     InputOptions
+		expected []string
+		fail     bool
+	}{
+		{name: "directory", args: []string{dir}, expected: []string{"app.json", "app.yaml"}},
+		{name: "recursive directory", args: []string{dir}, opts: InputOptions{Recursive: true},
+			expected: []string{"app.json", "app.yaml", "base/db.yml", "base/nested/job.yaml", "base/secret.yaml"}},
+		{name: "exclude by name", args: []string{dir}, opts: InputOptions{Recursive: true, Exclude: []string{"secret.yaml"}},
+			expected: []string{"app.json", "app.yaml", "base/db.yml", "base/nested/job.yaml"}},
+		{name: "include by relative path", args: []string{dir}, opts: InputOptions{Recursive: true, Include: []string{"base/*"}},
+			expected: []string{"base/db.yml", "base/secret.yaml"}},
+		{name: "glob", args: []string{filepath.Join(dir, "base", "*.y*ml")}, expected: []string{"db.yml", "secret.yaml"}},
+		{name: "glob of directories", args: []string{filepath.Join(dir, "b*")}, expected: []string{"db.yml", "secret.yaml"}},
+		{name: "file ignore extension", args: []string{filepath.Join(dir, "README.md")}, expected: []string{"README.md"}},
+		{name: "glob without match", args: []string{filepath.Join(dir, "*.txt")}, fail: true},
+		{name: "missing file", args: []string{filepath.Join(dir, "missing.yaml")}, fail: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inputs, err := CollectInputs(c.args, c.opts)
+			if c.fail {
+				if err == nil {
+					t.Fatalf("expected error, got %v", inputs)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			paths := []string{}
+			for _, input := range inputs {
+				paths = append(paths, filepath.ToSlash(input.RelativePath))
+			}
+			if !reflect.DeepEqual(paths, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, paths)
+			}
+		})
+	}
+}
+
+// TestOutputDir check a recursive directory is written to the output directory with the same layout
+func TestOutputDir(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	writeInputTree(t, dir, "app.yaml", "base/db.yml")
+
+	inputs, err := CollectInputs([]string{dir}, InputOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	transformer := Transformer{Generator: &g, Inputs: inputs, OutputDir: out}
+	if err = transformer.Transform(); err != nil {
+		t.Fatal(err)
+	}
+
+	injected := applyGenerator(t, &g, namespacedDeployment)
+	for _, rel := range []string{"app.yaml", "base/db.yml"} {
+		data, err := os.ReadFile(filepath.Join(out, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if documentJSON(t, string(data)) != injected {
+			t.Fatalf("expected %s injected, got %s", rel, data)
+		}
+	}
+}
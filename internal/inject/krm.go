@@ -0,0 +1,280 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+const (
+	resourceListKind       = "ResourceList"
+	resourceListAPIVersion = "config.kubernetes.io/v1"
+
+	severityError   = "error"
+	severityInfo    = "info"
+	configMapKind   = "ConfigMap"
+	listSeparator   = ","
+	krmFunctionName = "timezone-webhook"
+)
+
+// KRMFunctionConfig is the functionConfig of the KRM function, it could be a ConfigMap
+// with the same keys in data or any object with the fields in spec or at root
+type KRMFunctionConfig struct {
+	Timezone       string            `json:"timezone,omitempty"`
+	Strategy       InjectionStrategy `json:"strategy,omitempty"`
+	MountPath      string            `json:"mountPath,omitempty"`
+	HostPathPrefix string            `json:"hostPathPrefix,omitempty"`
+	ConfigMapName  string            `json:"configMapName,omitempty"`
+	// TimezoneFilePath and ZoneInfoPath are the extra mounts, see PatchGenerator
+	TimezoneFilePath string      `json:"timezoneFilePath,omitempty"`
+	ZoneInfoPath     string      `json:"zoneInfoPath,omitempty"`
+	Selector         KRMSelector `json:"selector,omitempty"`
+}
+
+// KRMSelector select the items injected by the KRM function, empty selector select all
+type KRMSelector struct {
+	Kinds         []string `json:"kinds,omitempty"`
+	Namespaces    []string `json:"namespaces,omitempty"`
+	LabelSelector string   `json:"labelSelector,omitempty"`
+}
+
+// resourceList is the input and output of KRM function
+type resourceList struct {
+	APIVersion     string            `json:"apiVersion"`
+	Kind           string            `json:"kind"`
+	Items          []json.RawMessage `json:"items"`
+	FunctionConfig json.RawMessage   `json:"functionConfig,omitempty"`
+	Results        []krmResult       `json:"results,omitempty"`
+}
+
+type krmResult struct {
+	Message     string          `json:"message"`
+	Severity    string          `json:"severity,omitempty"`
+	ResourceRef *krmResourceRef `json:"resourceRef,omitempty"`
+}
+
+type krmResourceRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// RunKRMFunction read a ResourceList from in, inject items selected by functionConfig with generator
+// honoring the annotations of items, functionConfig override the settings of its PatchGenerator,
+// the ResourceList is written to out with results for skipped items
+func RunKRMFunction(ctx context.Context, in io.Reader, out io.Writer, generator AnnotatedGenerator) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("failed to read ResourceList, error: %w", err)
+	}
+	data, err = yamlconvert.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("failed to read ResourceList, error: %w", err)
+	}
+
+	list := &resourceList{}
+	if err = json.Unmarshal(data, list); err != nil {
+		return fmt.Errorf("failed to read ResourceList, error: %w", err)
+	} else if list.Kind != resourceListKind {
+		return fmt.Errorf("input kind %q is not %s", list.Kind, resourceListKind)
+	}
+	if list.APIVersion == "" {
+		list.APIVersion = resourceListAPIVersion
+	}
+
+	config, err := parseKRMFunctionConfig(list.FunctionConfig)
+	if err != nil {
+		list.Results = append(list.Results, krmResult{Message: err.Error(), Severity: severityError})
+		return writeResourceList(out, list, err)
+	}
+	config.apply(&generator.PatchGenerator)
+
+	selector, err := labels.Parse(config.Selector.LabelSelector)
+	if err != nil {
+		err = fmt.Errorf("invalid labelSelector %q, error: %w", config.Selector.LabelSelector, err)
+		list.Results = append(list.Results, krmResult{Message: err.Error(), Severity: severityError})
+		return writeResourceList(out, list, err)
+	}
+
+	var failed error
+	for i, item := range list.Items {
+		injected, result, err := injectKRMItem(ctx, &generator, config.Selector, selector, item)
+		if err != nil {
+			failed = err
+		}
+		if result != nil {
+			list.Results = append(list.Results, *result)
+		}
+		if injected != nil {
+			list.Items[i] = injected
+		}
+	}
+
+	return writeResourceList(out, list, failed)
+}
+
+// injectKRMItem return the injected item, or a result explaining why the item is skipped
+func injectKRMItem(ctx context.Context, generator Generator, selection KRMSelector, selector labels.Selector, item []byte) ([]byte, *krmResult, error) {
+	meta := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(item, meta); err != nil {
+		return nil, &krmResult{Message: fmt.Sprintf("failed to read item: %v", err), Severity: severityError}, err
+	}
+	ref := &krmResourceRef{APIVersion: meta.APIVersion, Kind: meta.Kind, Name: meta.Name, Namespace: meta.Namespace}
+	skip := func(reason string) ([]byte, *krmResult, error) {
+		return nil, &krmResult{Message: fmt.Sprintf("skipped: %s", reason), Severity: severityInfo, ResourceRef: ref}, nil
+	}
+
+	obj, err := parseTypeMetaSkeleton(item)
+	if err != nil {
+		return nil, &krmResult{Message: err.Error(), Severity: severityError, ResourceRef: ref}, err
+	} else if obj == nil {
+		return skip("kind is not injectable")
+	}
+
+	if len(selection.Kinds) > 0 && !containsString(selection.Kinds, meta.Kind) {
+		return skip("kind is not selected")
+	} else if len(selection.Namespaces) > 0 && !containsString(selection.Namespaces, meta.Namespace) {
+		return skip("namespace is not selected")
+	} else if !selector.Matches(labels.Set(meta.Labels)) {
+		return skip("labels do not match labelSelector")
+	} else if _, ok := internal.LookupAnnotation(meta.Annotations, internal.InjectedAnnotation); ok {
+		return skip("already injected")
+	}
+
+	if err = json.Unmarshal(item, obj); err != nil {
+		return nil, &krmResult{Message: err.Error(), Severity: severityError, ResourceRef: ref}, err
+	}
+	patches, err := generator.Generate(ctx, obj, "")
+	if err != nil {
+		return nil, &krmResult{Message: err.Error(), Severity: severityError, ResourceRef: ref}, err
+	} else if len(patches) == 0 {
+		return skip("injection is not requested by annotations")
+	}
+	injected, err := applyPatches(item, patches)
+	if err != nil {
+		return nil, &krmResult{Message: err.Error(), Severity: severityError, ResourceRef: ref}, err
+	}
+	return injected, nil, nil
+}
+
+// parseKRMFunctionConfig read KRMFunctionConfig from a ConfigMap data, spec or root of functionConfig
+func parseKRMFunctionConfig(data json.RawMessage) (*KRMFunctionConfig, error) {
+	config := &KRMFunctionConfig{}
+	if len(data) == 0 || string(data) == "null" {
+		return config, nil
+	}
+
+	object := struct {
+		Kind string            `json:"kind"`
+		Data map[string]string `json:"data"`
+		Spec json.RawMessage   `json:"spec"`
+	}{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("invalid functionConfig, error: %w", err)
+	}
+
+	if object.Kind == configMapKind {
+		config.Timezone = object.Data["timezone"]
+		config.Strategy = InjectionStrategy(object.Data["strategy"])
+		config.MountPath = object.Data["mountPath"]
+		config.HostPathPrefix = object.Data["hostPathPrefix"]
+		config.ConfigMapName = object.Data["configMapName"]
+		config.TimezoneFilePath = object.Data["timezoneFilePath"]
+		config.ZoneInfoPath = object.Data["zoneInfoPath"]
+		config.Selector.Kinds = splitList(object.Data["kinds"])
+		config.Selector.Namespaces = splitList(object.Data["namespaces"])
+		config.Selector.LabelSelector = object.Data["labelSelector"]
+		return config, nil
+	}
+
+	if len(object.Spec) > 0 {
+		data = object.Spec
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid functionConfig, error: %w", err)
+	}
+	return config, nil
+}
+
+// apply override generator settings with non-empty config fields
+func (c *KRMFunctionConfig) apply(g *PatchGenerator) {
+	if c.Timezone != "" {
+		g.Timezone = c.Timezone
+	}
+	if c.Strategy != "" {
+		g.Strategy = c.Strategy
+	}
+	if c.MountPath != "" {
+		g.LocalTimePath = c.MountPath
+	}
+	if c.HostPathPrefix != "" {
+		g.HostPathPrefix = c.HostPathPrefix
+	}
+	if c.ConfigMapName != "" {
+		g.ConfigMapName = c.ConfigMapName
+	}
+	if c.TimezoneFilePath != "" {
+		g.TimezoneFilePath = c.TimezoneFilePath
+	}
+	if c.ZoneInfoPath != "" {
+		g.ZoneInfoPath = c.ZoneInfoPath
+	}
+}
+
+// writeResourceList write list as yaml to out and return failed
+func writeResourceList(out io.Writer, list *resourceList, failed error) error {
+	data, err := yamlconvert.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if _, err = out.Write(data); err != nil {
+		return fmt.Errorf("failed to write to standard output stream, error: %v", err)
+	}
+	if failed != nil {
+		return errors.New(krmFunctionName + " function failed, see results for details")
+	}
+	return nil
+}
+
+// applyPatches apply json patches to a json document
+func applyPatches(document []byte, patches internal.Patches) ([]byte, error) {
+	patchJSON, err := json.Marshal(patches)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return nil, err
+	}
+	return patch.Apply(document)
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, v := range strings.Split(value, listSeparator) {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
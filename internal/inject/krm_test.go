@@ -0,0 +1,157 @@
+package inject
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+const krmItems = `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: web, namespace: shop, labels: {app: web}}
+  spec: {containers: [{name: app, image: app}]}
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata: {name: api, namespace: billing}
+  spec: {template: {metadata: {}, spec: {containers: [{name: app, image: app}]}}}
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: config, namespace: shop}
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: done, namespace: shop, annotations: {"timezone.jugglechat.io/injected": "true"}}
+  spec: {containers: [{name: app, image: app}]}
+`
+
+// TestParseKRMFunctionConfig check functionConfig is read from ConfigMap data, spec or root
+func TestParseKRMFunctionConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected KRMFunctionConfig
+		fail     bool
+	}{
+		{name: "none", config: "null"},
+		{name: "configmap", config: `{"kind": "ConfigMap", "data": {"timezone": "Asia/Tokyo", "strategy": "hostPath", "kinds": "Pod, Deployment", "namespaces": "shop", "labelSelector": "app=web"}}`,
+			expected: KRMFunctionConfig{Timezone: "Asia/Tokyo", Strategy: HostPathInjectionStrategy,
+				Selector: KRMSelector{Kinds: []string{"Pod", "Deployment"}, Namespaces: []string{"shop"}, LabelSelector: "app=web"}}},
+		{name: "spec", config: `{"kind": "TimezoneInjection", "spec": {"timezone": "Europe/Paris", "selector": {"kinds": ["Pod"]}}}`,
+			expected: KRMFunctionConfig{Timezone: "Europe/Paris", Selector: KRMSelector{Kinds: []string{"Pod"}}}},
+		{name: "root", config: `{"kind": "TimezoneInjection", "mountPath": "/etc/tz", "configMapName": "tzdata"}`,
+			expected: KRMFunctionConfig{MountPath: "/etc/tz", ConfigMapName: "tzdata"}},
+		{name: "invalid", config: `{"kind": "TimezoneInjection", "spec": {"timezone": 1}}`, fail: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config, err := parseKRMFunctionConfig(json.RawMessage(c.config))
+			if c.fail {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", config)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*config, c.expected) {
+				t.Fatalf("expected %+v, got %+v", c.expected, *config)
+			}
+		})
+	}
+}
+
+// TestRunKRMFunction check the selected items are injected and the others are reported in results
+func TestRunKRMFunction(t *testing.T) {
+	cases := []struct {
+		name           string
+		functionConfig string
+		// injected are the names of injected items, results the messages per item name
+		injected []string
+		results  map[string]string
+		timezone string
+		fail     bool
+	}{
+		{name: "all", functionConfig: `{kind: ConfigMap, data: {timezone: Asia/Tokyo}}`, injected: []string{"web", "api"}, timezone: "Asia/Tokyo",
+			results: map[string]string{"config": "skipped: kind is not injectable", "done": "skipped: already injected"}},
+		{name: "kinds", functionConfig: `{kind: ConfigMap, data: {kinds: Deployment}}`, injected: []string{"api"}, timezone: internal.DefaultTimezone,
+			results: map[string]string{"web": "skipped: kind is not selected", "config": "skipped: kind is not injectable", "done": "skipped: kind is not selected"}},
+		{name: "namespaces", functionConfig: `{kind: ConfigMap, data: {namespaces: billing}}`, injected: []string{"api"}, timezone: internal.DefaultTimezone,
+			results: map[string]string{"web": "skipped: namespace is not selected", "config": "skipped: kind is not injectable", "done": "skipped: namespace is not selected"}},
+		{name: "label selector", functionConfig: `{kind: TimezoneInjection, spec: {selector: {labelSelector: app=web}}}`, injected: []string{"web"}, timezone: internal.DefaultTimezone,
+			results: map[string]string{"api": "skipped: labels do not match labelSelector", "config": "skipped: kind is not injectable", "done": "skipped: labels do not match labelSelector"}},
+		{name: "invalid label selector", functionConfig: `{kind: ConfigMap, data: {labelSelector: "app in"}}`, fail: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			input := krmItems + "functionConfig: " + c.functionConfig + "\n"
+			out := &bytes.Buffer{}
+			err := RunKRMFunction(context.TODO(), strings.NewReader(input), out, AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true})
+			list := readResourceList(t, out.Bytes())
+			if c.fail {
+				if err == nil || len(list.Results) != 1 || list.Results[0].Severity != severityError {
+					t.Fatalf("expected error result, got %v: %+v", err, list.Results)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			injected := []string{}
+			for _, item := range list.Items {
+				meta := &metav1.PartialObjectMetadata{}
+				if err = json.Unmarshal(item, meta); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := meta.Annotations[internal.InjectedAnnotation]; ok && meta.Name != "done" {
+					injected = append(injected, meta.Name)
+					if timezone := meta.Annotations[internal.InjectedTimezoneAnnotation]; timezone != c.timezone {
+						t.Fatalf("expected %s injected with %s, got %s", meta.Name, c.timezone, timezone)
+					}
+				}
+			}
+			if !reflect.DeepEqual(injected, c.injected) {
+				t.Fatalf("expected %v injected, got %v", c.injected, injected)
+			}
+
+			results := map[string]string{}
+			for _, result := range list.Results {
+				if result.ResourceRef == nil || result.Severity != severityInfo {
+					t.Fatalf("expected info result with resourceRef, got %+v", result)
+				}
+				results[result.ResourceRef.Name] = result.Message
+			}
+			if !reflect.DeepEqual(results, c.results) {
+				t.Fatalf("expected results %v, got %v", c.results, results)
+			}
+		})
+	}
+}
+
+// readResourceList decode the yaml output of RunKRMFunction
+func readResourceList(t *testing.T, data []byte) *resourceList {
+	data, err := yamlconvert.YAMLToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := &resourceList{}
+	if err = json.Unmarshal(data, list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Kind != resourceListKind || list.APIVersion != resourceListAPIVersion {
+		t.Fatalf("expected %s %s, got %s %s", resourceListAPIVersion, resourceListKind, list.APIVersion, list.Kind)
+	}
+	return list
+}
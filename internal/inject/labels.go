@@ -0,0 +1,48 @@
+package inject
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// LabelSource is a label rule matching labels of the pod
+const LabelSource Source = "label"
+
+// LabelTimezone set the timezone of pods matching Selector
+type LabelTimezone struct {
+	Selector labels.Selector
+	Timezone string
+}
+
+// ParseLabelTimezones parse rules like app.kubernetes.io/part-of=billing=America/New_York, the timezone
+// is after the last "=" and the label selector before it. Rules are matched in order
+func ParseLabelTimezones(rules []string) ([]LabelTimezone, error) {
+	parsed := make([]LabelTimezone, 0, len(rules))
+	for _, rule := range rules {
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 || i == len(rule)-1 {
+			return nil, fmt.Errorf("label timezone rule %q must be <selector>=<timezone>", rule)
+		}
+		selector, err := labels.Parse(rule[:i])
+		if err != nil {
+			return nil, fmt.Errorf("label timezone rule %q has invalid selector, error: %w", rule, err)
+		}
+		if selector.Empty() {
+			return nil, fmt.Errorf("label timezone rule %q has empty selector", rule)
+		}
+		parsed = append(parsed, LabelTimezone{Selector: selector, Timezone: rule[i+1:]})
+	}
+	return parsed, nil
+}
+
+// labelTimezone return the first rule matching podLabels
+func (g *AnnotatedGenerator) labelTimezone(podLabels map[string]string) (LabelTimezone, bool) {
+	for _, rule := range g.LabelTimezones {
+		if rule.Selector.Matches(labels.Set(podLabels)) {
+			return rule, true
+		}
+	}
+	return LabelTimezone{}, false
+}
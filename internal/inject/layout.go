@@ -0,0 +1,76 @@
+package inject
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// MountLayout is how the TZif file is mounted into containers
+type MountLayout string
+
+const (
+	// SubPathMountLayout mount the TZif file at LocalTimePath with subPath, kubelet never
+	// refreshes subPath mounts so tzdata updates need a restart
+	SubPathMountLayout MountLayout = "subpath"
+	// DirectoryMountLayout mount the zoneinfo as directory and point TZ at the TZif file with
+	// ":/path/Zone", so tzdata updates of configmap reach running pods
+	DirectoryMountLayout MountLayout = "directory"
+
+	// DefaultMountLayout is the default mount layout of every strategy
+	DefaultMountLayout = SubPathMountLayout
+	// DefaultZoneInfoMountDir is where configmap is mounted as directory by DirectoryMountLayout
+	DefaultZoneInfoMountDir = "/etc/timezone-webhook/zoneinfo"
+)
+
+// ParseMountLayouts parse mount layouts by strategy, e.g. configmap=directory
+func ParseMountLayouts(layouts map[string]string) (map[InjectionStrategy]MountLayout, error) {
+	parsed := make(map[InjectionStrategy]MountLayout, len(layouts))
+	for strategy, layout := range layouts {
+		switch InjectionStrategy(strategy) {
+		case ConfigMapInjectionStrategy, HostPathInjectionStrategy:
+		default:
+			return nil, fmt.Errorf("unknown injection strategy %q of mount layout", strategy)
+		}
+		switch MountLayout(layout) {
+		case SubPathMountLayout, DirectoryMountLayout:
+		default:
+			return nil, fmt.Errorf("unknown mount layout %q of strategy %s, supported layouts: %s, %s", layout, strategy, SubPathMountLayout, DirectoryMountLayout)
+		}
+		parsed[InjectionStrategy(strategy)] = MountLayout(layout)
+	}
+	return parsed, nil
+}
+
+// layout return the mount layout of strategy
+func (g *PatchGenerator) layout() MountLayout {
+	if layout, ok := g.MountLayouts[g.Strategy]; ok {
+		return layout
+	}
+	return DefaultMountLayout
+}
+
+// zoneInfoMountDir return where configmap is mounted by DirectoryMountLayout
+func (g *PatchGenerator) zoneInfoMountDir() string {
+	if g.ZoneInfoMountDir != "" {
+		return g.ZoneInfoMountDir
+	}
+	return DefaultZoneInfoMountDir
+}
+
+// TZValueFor return the value of TZ env injected into container, it is the TZif file path
+// of the mounted directory for DirectoryMountLayout
+func (g *PatchGenerator) TZValueFor(container string) string {
+	timezone := g.TimezoneFor(container)
+	if g.layout() != DirectoryMountLayout {
+		return timezone
+	}
+
+	switch g.Strategy {
+	case ConfigMapInjectionStrategy:
+		return ":" + path.Join(g.zoneInfoMountDir(), filepath.Base(timezone))
+	case HostPathInjectionStrategy:
+		return ":" + path.Join(g.hostPathZoneInfoPath(), timezone)
+	}
+	return timezone
+}
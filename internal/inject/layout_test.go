@@ -0,0 +1,101 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// injectPod inject a pod with containers by g and return the injected pod
+func injectPod(t *testing.T, g PatchGenerator, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+	for _, name := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: name, Image: name})
+	}
+	patches, err := g.Generate(context.TODO(), pod, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = applyPatches(data, patches); err != nil {
+		t.Fatal(err)
+	}
+	injected := &corev1.Pod{}
+	if err = json.Unmarshal(data, injected); err != nil {
+		t.Fatal(err)
+	}
+	return injected
+}
+
+// containerTZ return the TZ env of container
+func containerTZ(c corev1.Container) string {
+	for _, env := range c.Env {
+		if env.Name == TZEnvName {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+// TestMountLayout check TZ points at the TZif file of the mounted directory for directory layout
+// and the zone with a subPath mount for subpath layout
+func TestMountLayout(t *testing.T) {
+	cases := []struct {
+		name     string
+		strategy InjectionStrategy
+		layout   MountLayout
+		mountDir string
+		// expected TZ, mount path and subPath of the mount of TZif file
+		tz        string
+		mountPath string
+		subPath   string
+	}{
+		{name: "configmap subpath", strategy: ConfigMapInjectionStrategy, tz: "Asia/Shanghai", mountPath: DefaultLocalTimePath, subPath: "Shanghai"},
+		{name: "configmap directory", strategy: ConfigMapInjectionStrategy, layout: DirectoryMountLayout,
+			tz: ":" + DefaultZoneInfoMountDir + "/Shanghai", mountPath: DefaultZoneInfoMountDir},
+		{name: "configmap directory custom dir", strategy: ConfigMapInjectionStrategy, layout: DirectoryMountLayout, mountDir: "/zoneinfo",
+			tz: ":/zoneinfo/Shanghai", mountPath: "/zoneinfo"},
+		{name: "hostPath directory", strategy: HostPathInjectionStrategy, layout: DirectoryMountLayout,
+			tz: ":" + DefaultZoneInfoPath + "/Asia/Shanghai", mountPath: DefaultZoneInfoPath},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy, g.ZoneInfoMountDir = c.strategy, c.mountDir
+			if c.layout != "" {
+				g.MountLayouts = map[InjectionStrategy]MountLayout{c.strategy: c.layout}
+			}
+			container := injectPod(t, g, "app").Spec.Containers[0]
+
+			if tz := containerTZ(container); tz != c.tz {
+				t.Fatalf("expected TZ %s, got %s", c.tz, tz)
+			}
+			if len(container.VolumeMounts) != 1 {
+				t.Fatalf("expected a mount, got %v", container.VolumeMounts)
+			}
+			if mount := container.VolumeMounts[0]; mount.MountPath != c.mountPath || mount.SubPath != c.subPath {
+				t.Fatalf("expected mount at %s with subPath %q, got %+v", c.mountPath, c.subPath, mount)
+			}
+		})
+	}
+}
+
+// TestParseMountLayouts check unknown strategies and layouts are rejected
+func TestParseMountLayouts(t *testing.T) {
+	if layouts, err := ParseMountLayouts(map[string]string{"configmap": "directory", "hostPath": "subpath"}); err != nil ||
+		layouts[ConfigMapInjectionStrategy] != DirectoryMountLayout || layouts[HostPathInjectionStrategy] != SubPathMountLayout {
+		t.Fatalf("expected layouts parsed, got %v %v", layouts, err)
+	}
+	for _, layouts := range []map[string]string{{"initContainer": "directory"}, {"configmap": "tree"}} {
+		if _, err := ParseMountLayouts(layouts); err == nil {
+			t.Fatalf("expected %v rejected", layouts)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package inject
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+const (
+	// DefaultTimezoneFilePath is where Debian-based images and tzlocal read the zone name
+	DefaultTimezoneFilePath = "/etc/timezone"
+	// DefaultZoneInfoPath is where glibc and Java resolve zones
+	DefaultZoneInfoPath = DefaultHostPathPrefix
+
+	// TimezoneFileVolumeName is the downwardAPI volume of the timezone file
+	TimezoneFileVolumeName = "zoneinfo-timezone"
+	// ZoneInfoTreeVolumeName is the configmap volume laid out as zoneinfo tree, its zones are mounted one by one
+	ZoneInfoTreeVolumeName = "zoneinfo-tree"
+
+	// timezoneFileName is the file of pod timezone in timezone file volume
+	timezoneFileName = "timezone"
+)
+
+// createTimezoneFilePatches mount a file containing the zone name at TimezoneFilePath, the file is
+// projected from the post-injection timezone annotations by downwardAPI so it works with every strategy
+func (g *PatchGenerator) createTimezoneFilePatches(spec *corev1.PodSpec, pathPrefix string) internal.Patches {
+	var patches = internal.Patches{}
+	if g.TimezoneFilePath == "" || len(spec.Containers) == 0 {
+		return patches
+	}
+
+	items := []corev1.DownwardAPIVolumeFile{timezoneFileItem(timezoneFileName, internal.InjectedTimezoneAnnotation)}
+	for _, name := range sortedContainerNames(g.ContainerTimezones) {
+		items = append(items, timezoneFileItem(timezoneFileName+"."+name, internal.InjectedContainerTimezoneAnnotationPrefix+name))
+	}
+	patches = append(patches, internal.Patch{
+		Op:   "add",
+		Path: fmt.Sprintf("%s/volumes/-", pathPrefix),
+		Value: corev1.Volume{
+			Name:         TimezoneFileVolumeName,
+			VolumeSource: corev1.VolumeSource{DownwardAPI: &corev1.DownwardAPIVolumeSource{Items: items}},
+		},
+	})
+
+	for containerID, c := range spec.Containers {
+		subPath := timezoneFileName
+		if _, ok := g.ContainerTimezones[c.Name]; ok {
+			subPath = timezoneFileName + "." + c.Name
+		}
+		patches = append(patches, internal.Patch{
+			Op:   "add",
+			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
+			Value: corev1.VolumeMount{
+				Name:      TimezoneFileVolumeName,
+				ReadOnly:  true,
+				MountPath: g.TimezoneFilePath,
+				SubPath:   subPath,
+			},
+		})
+	}
+	return patches
+}
+
+// createZoneInfoTreePatches mount the zone of every container from zoneinfo configmap into the zoneinfo tree
+// at ZoneInfoPath, e.g. ZoneInfoPath/Asia/Shanghai. Every zone is mounted as a single file by subPath, so the
+// other zones of the image are still resolvable. hostPath strategy always mount the tree of node
+func (g *PatchGenerator) createZoneInfoTreePatches(spec *corev1.PodSpec, pathPrefix string) internal.Patches {
+	var patches = internal.Patches{}
+	if g.ZoneInfoPath == "" || g.Strategy != ConfigMapInjectionStrategy || len(spec.Containers) == 0 {
+		return patches
+	}
+
+	zones := map[string]bool{}
+	for _, c := range spec.Containers {
+		zones[g.TimezoneFor(c.Name)] = true
+	}
+	items := make([]corev1.KeyToPath, 0, len(zones))
+	for zone := range zones {
+		items = append(items, corev1.KeyToPath{Key: filepath.Base(zone), Path: zone})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+
+	patches = append(patches, internal.Patch{
+		Op:   "add",
+		Path: fmt.Sprintf("%s/volumes/-", pathPrefix),
+		Value: corev1.Volume{
+			Name: ZoneInfoTreeVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: g.ConfigMapName},
+					Items:                items,
+				},
+			},
+		},
+	})
+	for containerID, c := range spec.Containers {
+		zone := g.TimezoneFor(c.Name)
+		patches = append(patches, internal.Patch{
+			Op:   "add",
+			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathPrefix, containerID),
+			Value: corev1.VolumeMount{
+				Name:      ZoneInfoTreeVolumeName,
+				ReadOnly:  true,
+				MountPath: path.Join(g.ZoneInfoPath, zone),
+				SubPath:   zone,
+			},
+		})
+	}
+	return patches
+}
+
+// hostPathZoneInfoPath return where hostPath strategy mount the zoneinfo tree of node
+func (g *PatchGenerator) hostPathZoneInfoPath() string {
+	if g.ZoneInfoPath != "" {
+		return g.ZoneInfoPath
+	}
+	return DefaultZoneInfoPath
+}
+
+func timezoneFileItem(path, annotation string) corev1.DownwardAPIVolumeFile {
+	return corev1.DownwardAPIVolumeFile{
+		Path:     path,
+		FieldRef: &corev1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.annotations['%s']", annotation)},
+	}
+}
+
+func sortedContainerNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// TestTimezoneFileAnnotations check every file of the timezone file volume is projected from an annotation
+// written by injection, wherever the timezone of container comes from
+func TestTimezoneFileAnnotations(t *testing.T) {
+	cases := []struct {
+		name string
+		// prefixes are the annotation prefixes, keys of annotations are relative to the primary prefix
+		prefixes             []string
+		annotations          map[string]string
+		namespaceAnnotations map[string]string
+	}{
+		{name: "object", annotations: map[string]string{"timezone.app": "Asia/Calcutta"}},
+		{name: "namespace", namespaceAnnotations: map[string]string{"timezone.app": "Asia/Calcutta"}},
+		{name: "legacy prefix", prefixes: []string{"tz.example.com", internal.DefaultAnnotationPrefix},
+			annotations: map[string]string{internal.DefaultAnnotationPrefix + "/timezone.app": "Asia/Calcutta"}},
+	}
+	defer internal.SetAnnotationPrefixes(nil) //nolint:errcheck
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := internal.SetAnnotationPrefixes(c.prefixes); err != nil {
+				t.Fatal(err)
+			}
+			primary := internal.AnnotationPrefixes()[0]
+			prefixed := func(annotations map[string]string) map[string]string {
+				result := map[string]string{}
+				for k, v := range annotations {
+					if !strings.Contains(k, "/") {
+						k = primary + "/" + k
+					}
+					result[k] = v
+				}
+				return result
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: prefixed(c.annotations)},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}, {Name: "sidecar", Image: "sidecar"}}},
+			}
+			g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+			g.TimezoneFilePath = DefaultTimezoneFilePath
+			decision := g.Decide(pod.Annotations, prefixed(c.namespaceAnnotations), pod.Labels, &pod.Spec)
+			if decision.Generator == nil {
+				t.Fatalf("expected pod injected: %s", decision.Reason)
+			}
+			patches, err := decision.Generator.Generate(context.TODO(), pod, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = applyPatches(data, patches); err != nil {
+				t.Fatal(err)
+			}
+			injected := &corev1.Pod{}
+			if err = json.Unmarshal(data, injected); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := map[string]string{timezoneFileName: internal.DefaultTimezone, timezoneFileName + ".app": "Asia/Calcutta"}
+			files := map[string]string{}
+			for _, v := range injected.Spec.Volumes {
+				if v.Name != TimezoneFileVolumeName {
+					continue
+				}
+				for _, item := range v.DownwardAPI.Items {
+					key := strings.TrimSuffix(strings.TrimPrefix(item.FieldRef.FieldPath, "metadata.annotations['"), "']")
+					if !strings.HasPrefix(key, primary+"/") {
+						t.Fatalf("expected %s projected from an annotation under the primary prefix, got %s", item.Path, key)
+					}
+					files[item.Path] = injected.Annotations[key]
+				}
+			}
+			for path, timezone := range expected {
+				if files[path] != timezone {
+					t.Fatalf("expected file %s contains %s, got %q", path, timezone, files[path])
+				}
+			}
+		})
+	}
+}
+
+// shadowed report whether file of image is hidden by a mount of container, a mount with subPath
+// only hide the file it is mounted at
+func shadowed(c corev1.Container, file string) bool {
+	for _, m := range c.VolumeMounts {
+		if file == m.MountPath || (m.SubPath == "" && strings.HasPrefix(file, m.MountPath+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestZoneInfoTree check configmap strategy mount the zone of every container into the zoneinfo tree
+// of image without hiding the other zones of it
+func TestZoneInfoTree(t *testing.T) {
+	g := NewPatchGenerator()
+	g.ZoneInfoPath = DefaultZoneInfoPath
+	g.ContainerTimezones = map[string]string{"app": "Asia/Tokyo"}
+	pod := injectPod(t, g, "app", "sidecar")
+
+	var items []corev1.KeyToPath
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == ZoneInfoTreeVolumeName {
+			items = v.ConfigMap.Items
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		zone := g.TimezoneFor(c.Name)
+		mounted := false
+		for _, m := range c.VolumeMounts {
+			if m.Name != ZoneInfoTreeVolumeName {
+				continue
+			}
+			if m.MountPath != DefaultZoneInfoPath+"/"+zone || m.SubPath != zone {
+				t.Fatalf("expected %s mounted at %s/%s, got %s subPath %s", zone, DefaultZoneInfoPath, zone, m.MountPath, m.SubPath)
+			}
+			for _, item := range items {
+				mounted = mounted || item.Path == m.SubPath
+			}
+		}
+		if !mounted {
+			t.Fatalf("expected %s of container %s mounted from %v", zone, c.Name, items)
+		}
+		if file := DefaultZoneInfoPath + "/Europe/Paris"; shadowed(c, file) {
+			t.Fatalf("expected %s of image still present in container %s, mounts %v", file, c.Name, c.VolumeMounts)
+		}
+	}
+}
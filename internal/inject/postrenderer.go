@@ -0,0 +1,19 @@
+package inject
+
+import (
+	"io"
+)
+
+// RunPostRenderer run as a helm post-renderer, inject the manifests stream read from in and write it to out.
+// Documents which are not injected are written as-is, so it is safe to chain renderers
+func RunPostRenderer(in io.Reader, out io.Writer, generator Generator) error {
+	transformer := &Transformer{
+		Generator: generator,
+		Inputs:    Inputs{{Identifier: "-", Reader: in}},
+		Output:    out,
+		Format:    YAMLOutputFormat,
+
+		PreserveFormatting: true,
+	}
+	return transformer.Transform()
+}
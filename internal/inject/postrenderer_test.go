@@ -0,0 +1,76 @@
+package inject
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const renderedConfigMap = `# Source: chart/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  # keep this comment
+  key:   "value"   # trailing
+`
+
+const renderedService = `# Source: chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata: {name: app}
+spec:
+  ports: [{port: 80}]
+`
+
+const renderedDeployment = `# Source: chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: app
+`
+
+const renderedSkippedPod = `apiVersion: v1
+kind: Pod
+metadata:
+  name: skipped
+  annotations:
+    timezone.jugglechat.io/inject: "false"
+spec:
+  containers:
+  - name: app
+    image:   app
+`
+
+// TestPostRendererMixedManifests check a mixed multi-document manifest is injected, documents which are
+// not injected pass through byte for byte
+func TestPostRendererMixedManifests(t *testing.T) {
+	in := strings.Join([]string{renderedConfigMap, renderedService, renderedDeployment, renderedSkippedPod}, "---\n")
+	out := &bytes.Buffer{}
+	injector := &AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	if err := RunPostRenderer(strings.NewReader(in), out, injector); err != nil {
+		t.Fatal(err)
+	}
+
+	documents := strings.Split(out.String(), "---\n")
+	if len(documents) != 4 {
+		t.Fatalf("expected 4 documents, got %d:\n%s", len(documents), out)
+	}
+	for i, expected := range map[int]string{0: renderedConfigMap, 1: renderedService, 3: renderedSkippedPod} {
+		if documents[i] != expected {
+			t.Fatalf("expected document %d unchanged\nexpected:\n%s\ngot:\n%s", i, expected, documents[i])
+		}
+	}
+	if !strings.Contains(documents[2], "name: TZ") {
+		t.Fatalf("expected deployment injected, got:\n%s", documents[2])
+	}
+}
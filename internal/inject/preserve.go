@@ -0,0 +1,445 @@
+package inject
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// defaultYAMLIndent is used when indent could not be detected from document
+const defaultYAMLIndent = 2
+
+var jsonPointerUnescapeReplacer = strings.NewReplacer("~1", "/", "~0", "~")
+
+// yamlDocument is the text of a yaml document edited line by line,
+// only the lines of patched nodes are rewritten, everything else stays byte-identical
+type yamlDocument struct {
+	lines  []string
+	indent int
+}
+
+// pathStep is a container node on the way to the patched node and the token selecting its child
+type pathStep struct {
+	node  *yaml.Node
+	token string
+}
+
+// applyPatchesPreservingFormat apply patches on yaml document, expected is the json of the
+// document with the same patches applied and is used to verify the result
+func applyPatchesPreservingFormat(document []byte, patches internal.Patches, expected []byte) ([]byte, error) {
+	d := &yamlDocument{lines: strings.Split(string(document), "\n")}
+	d.indent = d.detectIndent()
+
+	for _, p := range patches {
+		if err := d.apply(p); err != nil {
+			return nil, fmt.Errorf("failed to apply %s %s, error: %w", p.Op, p.Path, err)
+		}
+	}
+
+	result := []byte(strings.Join(d.lines, "\n"))
+	if err := sameJSON(result, expected); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sameJSON check the yaml document is semantically equal to expected json
+func sameJSON(document, expected []byte) error {
+	actualJSON, err := yamlconvert.YAMLToJSON(document)
+	if err != nil {
+		return err
+	}
+	var actual, want interface{}
+	if err = json.Unmarshal(actualJSON, &actual); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(expected, &want); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(actual, want) {
+		return errors.New("formatting preserved document differs from patched object")
+	}
+	return nil
+}
+
+func (d *yamlDocument) parse() (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte(strings.Join(d.lines, "\n")), doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, errors.New("empty yaml document")
+	}
+	return doc.Content[0], nil
+}
+
+func (d *yamlDocument) apply(p internal.Patch) error {
+	root, err := d.parse()
+	if err != nil {
+		return err
+	}
+
+	tokens := strings.Split(strings.TrimPrefix(p.Path, "/"), "/")
+	for i := range tokens {
+		tokens[i] = jsonPointerUnescapeReplacer.Replace(tokens[i])
+	}
+	steps, err := resolvePath(root, tokens)
+	if err != nil {
+		return err
+	}
+
+	var value *yaml.Node
+	if p.Op != "remove" {
+		if value, err = valueNode(p.Value); err != nil {
+			return err
+		}
+	}
+
+	last := steps[len(steps)-1]
+	switch last.node.Kind {
+	case yaml.MappingNode:
+		return d.applyMapping(steps, p.Op, value)
+	case yaml.SequenceNode:
+		return d.applySequence(steps, p.Op, value)
+	}
+	return fmt.Errorf("path parent is not a container")
+}
+
+func (d *yamlDocument) applyMapping(steps []pathStep, op string, value *yaml.Node) error {
+	last := steps[len(steps)-1]
+	m, key := last.node, last.token
+	index := mappingIndex(m, key)
+	block := isBlock(m)
+
+	switch op {
+	case "add", "replace":
+		if index >= 0 && block {
+			return d.replaceEntry(m, index, value)
+		} else if index < 0 && op == "add" && block {
+			return d.insertEntry(m, key, value)
+		} else if index >= 0 {
+			m.Content[index*2+1] = value
+		} else if op == "add" {
+			if len(m.Content) == 0 {
+				// empty flow mapping like {} is written in block style once it gets entries
+				m.Style = 0
+			}
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+		} else {
+			return fmt.Errorf("key %s not found", key)
+		}
+	case "remove":
+		if index < 0 {
+			return fmt.Errorf("key %s not found", key)
+		}
+		if block && len(m.Content) > 2 {
+			start, end := d.entryRegion(m.Content[index*2])
+			d.replaceLines(start, end, nil)
+			return nil
+		}
+		m.Content = append(m.Content[:index*2], m.Content[index*2+2:]...)
+	default:
+		return fmt.Errorf("unsupported operation %s", op)
+	}
+	return d.rerender(steps, len(steps)-1)
+}
+
+func (d *yamlDocument) applySequence(steps []pathStep, op string, value *yaml.Node) error {
+	last := steps[len(steps)-1]
+	s := last.node
+	block := isBlock(s)
+
+	index := len(s.Content)
+	if last.token != "-" {
+		i, err := strconv.Atoi(last.token)
+		if err != nil || i < 0 || i > len(s.Content) || (op != "add" && i == len(s.Content)) {
+			return fmt.Errorf("invalid sequence index %s", last.token)
+		}
+		index = i
+	}
+
+	switch op {
+	case "add":
+		if index == len(s.Content) && block {
+			return d.appendItem(s, value)
+		}
+		if len(s.Content) == 0 {
+			// empty flow sequence like [] is written in block style once it gets items
+			s.Style = 0
+		}
+		s.Content = append(s.Content[:index], append([]*yaml.Node{value}, s.Content[index:]...)...)
+	case "replace":
+		if block {
+			return d.replaceItem(s, index, value)
+		}
+		s.Content[index] = value
+	case "remove":
+		if block && len(s.Content) > 1 {
+			start, end := d.itemRegion(s.Content[index])
+			d.replaceLines(start, end, nil)
+			return nil
+		}
+		s.Content = append(s.Content[:index], s.Content[index+1:]...)
+	default:
+		return fmt.Errorf("unsupported operation %s", op)
+	}
+	return d.rerender(steps, len(steps)-1)
+}
+
+// rerender write the container at steps[i], which was changed in memory, back to the text,
+// as value of its parent entry or item; flow style parents are rendered as a whole
+func (d *yamlDocument) rerender(steps []pathStep, i int) error {
+	if i == 0 {
+		lines, err := d.encode(steps[0].node)
+		if err != nil {
+			return err
+		}
+		d.lines = append(lines, "")
+		return nil
+	}
+
+	parent := steps[i-1]
+	if !isBlock(parent.node) {
+		return d.rerender(steps, i-1)
+	}
+	switch parent.node.Kind {
+	case yaml.MappingNode:
+		index := mappingIndex(parent.node, parent.token)
+		return d.replaceEntry(parent.node, index, parent.node.Content[index*2+1])
+	case yaml.SequenceNode:
+		index, _ := strconv.Atoi(parent.token) //nolint:errcheck
+		return d.replaceItem(parent.node, index, parent.node.Content[index])
+	}
+	return errors.New("path parent is not a container")
+}
+
+func (d *yamlDocument) insertEntry(m *yaml.Node, key string, value *yaml.Node) error {
+	_, end := d.entryRegion(m.Content[len(m.Content)-2])
+	lines, err := d.renderEntry(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	if err != nil {
+		return err
+	}
+	d.replaceLines(end+1, end, indentLines(lines, spaces(m.Content[0].Column-1), spaces(m.Content[0].Column-1)))
+	return nil
+}
+
+func (d *yamlDocument) replaceEntry(m *yaml.Node, index int, value *yaml.Node) error {
+	keyNode := m.Content[index*2]
+	start, end := d.entryRegion(keyNode)
+	lines, err := d.renderEntry(&yaml.Node{Kind: yaml.ScalarNode, Tag: keyNode.Tag, Style: keyNode.Style, Value: keyNode.Value}, value)
+	if err != nil {
+		return err
+	}
+	first := d.lines[start][:keyNode.Column-1]
+	d.replaceLines(start, end, indentLines(lines, first, spaces(keyNode.Column-1)))
+	return nil
+}
+
+func (d *yamlDocument) appendItem(s *yaml.Node, value *yaml.Node) error {
+	_, end := d.itemRegion(s.Content[len(s.Content)-1])
+	lines, err := d.renderItem(value)
+	if err != nil {
+		return err
+	}
+	prefix := spaces(d.dashIndent(s.Content[0]))
+	d.replaceLines(end+1, end, indentLines(lines, prefix, prefix))
+	return nil
+}
+
+func (d *yamlDocument) replaceItem(s *yaml.Node, index int, value *yaml.Node) error {
+	start, end := d.itemRegion(s.Content[index])
+	lines, err := d.renderItem(value)
+	if err != nil {
+		return err
+	}
+	prefix := spaces(d.dashIndent(s.Content[index]))
+	d.replaceLines(start, end, indentLines(lines, prefix, prefix))
+	return nil
+}
+
+// replaceLines replace lines[start:end+1] with lines, start = end+1 insert before start
+func (d *yamlDocument) replaceLines(start, end int, lines []string) {
+	result := make([]string, 0, len(d.lines)+len(lines))
+	result = append(result, d.lines[:start]...)
+	result = append(result, lines...)
+	result = append(result, d.lines[end+1:]...)
+	d.lines = result
+}
+
+// entryRegion return the first and last line of a mapping entry
+func (d *yamlDocument) entryRegion(keyNode *yaml.Node) (int, int) {
+	start := keyNode.Line - 1
+	return start, d.regionEnd(start, keyNode.Column-1, false)
+}
+
+// itemRegion return the first and last line of a sequence item
+func (d *yamlDocument) itemRegion(item *yaml.Node) (int, int) {
+	start := item.Line - 1
+	return start, d.regionEnd(start, d.dashIndent(item), true)
+}
+
+// regionEnd find the last content line belonging to the node starting at line start with indent,
+// a compact sequence at the same indent belongs to a mapping entry but ends a sequence item
+func (d *yamlDocument) regionEnd(start, indent int, item bool) int {
+	last := start
+	for j := start + 1; j < len(d.lines); j++ {
+		trimmed := strings.TrimSpace(d.lines[j])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineIndent := len(d.lines[j]) - len(strings.TrimLeft(d.lines[j], " "))
+		if lineIndent < indent || (lineIndent == indent && (item || !strings.HasPrefix(trimmed, "-"))) {
+			break
+		}
+		last = j
+	}
+	return last
+}
+
+// dashIndent return the indent of the dash of a sequence item
+func (d *yamlDocument) dashIndent(item *yaml.Node) int {
+	line := d.lines[item.Line-1]
+	if i := strings.LastIndex(line[:item.Column-1], "-"); i >= 0 {
+		return i
+	}
+	return item.Column - 1
+}
+
+func (d *yamlDocument) renderEntry(key, value *yaml.Node) ([]string, error) {
+	return d.encode(&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{key, value}})
+}
+
+func (d *yamlDocument) renderItem(value *yaml.Node) ([]string, error) {
+	lines, err := d.encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return indentLines(lines, "- ", "  "), nil
+}
+
+func (d *yamlDocument) encode(node *yaml.Node) ([]string, error) {
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(d.indent)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+// detectIndent return the smallest indent step used by document
+func (d *yamlDocument) detectIndent() int {
+	indent := 0
+	previous := 0
+	for _, line := range d.lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		current := len(line) - len(strings.TrimLeft(line, " "))
+		if step := current - previous; step > 0 && (indent == 0 || step < indent) {
+			indent = step
+		}
+		previous = current
+	}
+	if indent < 2 {
+		return defaultYAMLIndent
+	}
+	return indent
+}
+
+// resolvePath return the containers from root to the parent of the last token
+func resolvePath(root *yaml.Node, tokens []string) ([]pathStep, error) {
+	steps := make([]pathStep, 0, len(tokens))
+	node := root
+	for i, token := range tokens {
+		steps = append(steps, pathStep{node: node, token: token})
+		if i == len(tokens)-1 {
+			break
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			index := mappingIndex(node, token)
+			if index < 0 {
+				return nil, fmt.Errorf("key %s not found", token)
+			}
+			node = node.Content[index*2+1]
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node.Content) {
+				return nil, fmt.Errorf("invalid sequence index %s", token)
+			}
+			node = node.Content[index]
+		default:
+			return nil, fmt.Errorf("%s is not a container", token)
+		}
+	}
+	return steps, nil
+}
+
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i / 2
+		}
+	}
+	return -1
+}
+
+// isBlock report whether node is a non-empty block style container which could be edited line by line
+func isBlock(node *yaml.Node) bool {
+	return node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0 && node.Line > 0
+}
+
+// valueNode convert a patch value to a block style yaml node
+func valueNode(value interface{}) (*yaml.Node, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	node := doc.Content[0]
+	resetStyle(node)
+	return node, nil
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	node.Line, node.Column = 0, 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+func indentLines(lines []string, first, rest string) []string {
+	result := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if i == 0 {
+			result = append(result, first+line)
+		} else if line == "" {
+			result = append(result, line)
+		} else {
+			result = append(result, rest+line)
+		}
+	}
+	return result
+}
+
+func spaces(n int) string {
+	return strings.Repeat(" ", n)
+}
@@ -0,0 +1,89 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	appsv1 "k8s.io/api/apps/v1"
+	yamlconvert "sigs.k8s.io/yaml"
+)
+
+const commentedDeployment = `# deployment comment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app   # name comment
+  labels: {app: app}
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: "app:1"
+        env:
+        - name: FOO
+          value: bar  # keep me
+      volumes:
+        - name: data
+          emptyDir: {}
+`
+
+func applyPreserving(t *testing.T, g Generator, document string) string {
+	obj := &appsv1.Deployment{}
+	if err := yamlconvert.Unmarshal([]byte(document), obj); err != nil {
+		t.Fatal(err)
+	}
+	patches, err := g.Generate(context.TODO(), obj, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchJSON, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origJSON, err := yamlconvert.YAMLToJSON([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := patch.Apply(origJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := applyPatchesPreservingFormat([]byte(document), patches, expected)
+	if err != nil {
+		t.Fatalf("failed to apply patches preserving format: %v", err)
+	}
+	return string(result)
+}
+
+func TestApplyPatchesPreservingFormat(t *testing.T) {
+	g := NewPatchGenerator()
+	injected := applyPreserving(t, &g, commentedDeployment)
+
+	for _, expected := range []string{
+		"# deployment comment\n",
+		"  name: app   # name comment\n",
+		"  labels: {app: app}\n",
+		"          value: bar  # keep me\n        - name: TZ\n          value: Asia/Shanghai\n",
+		"        - name: data\n          emptyDir: {}\n        - name: zoneinfo-configmap\n",
+	} {
+		if !strings.Contains(injected, expected) {
+			t.Errorf("expected injected document to contain %q, got:\n%s", expected, injected)
+		}
+	}
+
+	if stripped := applyPreserving(t, &Uninjector{}, injected); stripped != commentedDeployment {
+		t.Errorf("expected uninject to restore the original document, got:\n%s", stripped)
+	}
+}
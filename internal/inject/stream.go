@@ -0,0 +1,88 @@
+package inject
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// streamFormat is the layout of documents in an input
+type streamFormat int
+
+const (
+	// yamlStream is yaml documents separated by "---"
+	yamlStream streamFormat = iota
+	// jsonObject is a single json object, e.g. output of kubectl get -o json
+	jsonObject
+	// jsonArray is a json array of objects
+	jsonArray
+	// jsonLines is newline-delimited json objects
+	jsonLines
+)
+
+// readDocuments read all documents from reader and detect the layout of them,
+// input which could not be decoded as json is read as yaml
+func readDocuments(reader io.Reader) ([][]byte, streamFormat, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, yamlStream, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err = json.Unmarshal(trimmed, &items); err == nil {
+			documents := make([][]byte, 0, len(items))
+			for _, item := range items {
+				documents = append(documents, item)
+			}
+			return documents, jsonArray, nil
+		}
+	}
+
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if documents, err := readJSONObjects(trimmed); err == nil {
+			if len(documents) == 1 {
+				return documents, jsonObject, nil
+			}
+			return documents, jsonLines, nil
+		}
+	}
+
+	return readYAMLDocuments(data)
+}
+
+// readJSONObjects read concatenated or newline-delimited json objects
+func readJSONObjects(data []byte) ([][]byte, error) {
+	documents := [][]byte{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var document json.RawMessage
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+}
+
+func readYAMLDocuments(data []byte) ([][]byte, streamFormat, error) {
+	reader := yaml.NewYAMLReader(bufio.NewReaderSize(bytes.NewReader(data), readerSize))
+	documents := [][]byte{}
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			return documents, yamlStream, nil
+		}
+		if err != nil {
+			return nil, yamlStream, err
+		}
+		documents = append(documents, document)
+	}
+}
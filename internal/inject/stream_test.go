@@ -0,0 +1,89 @@
+package inject
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const (
+	jsonPod = `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "app"}, "spec": {"containers": [{"name": "app", "image": "app"}]}}`
+	jsonJob = `{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": "job"}}`
+)
+
+// TestReadDocuments check the layout of input is detected and every document is read
+func TestReadDocuments(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     string
+		stream    streamFormat
+		documents int
+	}{
+		{name: "yaml", input: plainPod, stream: yamlStream, documents: 1},
+		{name: "yaml stream", input: plainPod + "---\n" + namespacedDeployment, stream: yamlStream, documents: 2},
+		{name: "json object", input: jsonPod, stream: jsonObject, documents: 1},
+		{name: "indented json object", input: "\n  " + jsonPod + "\n", stream: jsonObject, documents: 1},
+		{name: "json array", input: "[" + jsonPod + ", " + jsonJob + "]", stream: jsonArray, documents: 2},
+		{name: "empty json array", input: "[]", stream: jsonArray, documents: 0},
+		{name: "json lines", input: jsonPod + "\n" + jsonJob + "\n", stream: jsonLines, documents: 2},
+		{name: "flow yaml is not json", input: "{apiVersion: v1, kind: Pod}", stream: yamlStream, documents: 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			documents, stream, err := readDocuments(strings.NewReader(c.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stream != c.stream || len(documents) != c.documents {
+				t.Fatalf("expected %d documents of layout %d, got %d documents of layout %d", c.documents, c.stream, len(documents), stream)
+			}
+		})
+	}
+}
+
+// TestJSONOutputLayout check json inputs are written as json in the same layout unless a format is set
+func TestJSONOutputLayout(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		format OutputFormat
+		// check the output, documents is the number of json values in output
+		prefix    string
+		documents int
+	}{
+		{name: "json object", input: jsonPod, prefix: "{\n" + jsonIndent, documents: 1},
+		{name: "json array", input: "[" + jsonPod + "," + jsonJob + "]", prefix: "[\n" + jsonIndent, documents: 1},
+		{name: "json lines", input: jsonPod + "\n" + jsonJob, prefix: "{\"apiVersion\"", documents: 2},
+		{name: "json object as yaml", input: jsonPod, format: YAMLOutputFormat, prefix: "apiVersion: v1\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			output := transform(t, c.format, c.input)
+			if !strings.HasPrefix(output, c.prefix) {
+				t.Fatalf("expected output start with %q, got %s", c.prefix, output)
+			}
+			if c.documents == 0 {
+				return
+			}
+
+			documents := 0
+			decoder := json.NewDecoder(bytes.NewReader([]byte(output)))
+			for decoder.More() {
+				var document json.RawMessage
+				if err := decoder.Decode(&document); err != nil {
+					t.Fatalf("expected json output, got %s: %v", output, err)
+				}
+				documents++
+			}
+			if documents != c.documents {
+				t.Fatalf("expected %d json values, got %d: %s", c.documents, documents, output)
+			}
+			if !strings.Contains(output, `"name":"TZ"`) && !strings.Contains(output, `"name": "TZ"`) {
+				t.Fatalf("expected pod injected, got %s", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package inject
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// injectedVolumeNames are the volume names PatchGenerator may add to pod spec, volumes of
+// hostPath strategy are matched by isHostPathVolume
+var injectedVolumeNames = map[string]InjectionStrategy{
+	DefaultVolumeName: ConfigMapInjectionStrategy,
+	// extra mounts do not tell the strategy
+	TimezoneFileVolumeName: "",
+	ZoneInfoTreeVolumeName: "",
+}
+
+// injectedVolume report whether volume name was added by PatchGenerator and the strategy it tells
+func injectedVolume(name string) (InjectionStrategy, bool) {
+	if isHostPathVolume(name) {
+		return HostPathInjectionStrategy, true
+	}
+	strategy, ok := injectedVolumeNames[name]
+	return strategy, ok
+}
+
+// InjectedStrategy detect which strategy was used by a previous injection into spec, empty when nothing injected
+func InjectedStrategy(spec *corev1.PodSpec) InjectionStrategy {
+	for _, v := range spec.Volumes {
+		if strategy, ok := injectedVolume(v.Name); ok && strategy != "" {
+			return strategy
+		}
+	}
+	return ""
+}
+
+// InjectedTimezones return the TZ injected into every container by name, containers not recorded in
+// annotations were not injected. PatchGenerator append TZ to the end of env, so the last one is injected
+func InjectedTimezones(spec *corev1.PodSpec, annotations map[string]string) map[string]string {
+	envs := injectedEnvsOf(spec, annotations)
+	timezones := map[string]string{}
+	for _, c := range spec.Containers {
+		if !envs.added(c.Name, TZEnvName) {
+			continue
+		}
+		for _, env := range c.Env {
+			if env.Name == TZEnvName {
+				timezones[c.Name] = env.Value
+			}
+		}
+	}
+	return timezones
+}
+
+// injectedEnvsOf return the env vars recorded in annotations, or the legacy record of spec
+func injectedEnvsOf(spec *corev1.PodSpec, annotations map[string]string) injectedEnvs {
+	if envs := parseInjectedEnvs(annotations); envs != nil {
+		return envs
+	}
+	return legacyInjectedEnvs(spec)
+}
+
+// InjectedTimezone return the timezone recorded by a previous injection, injections before the record
+// was added wrote it to TimezoneAnnotation
+func InjectedTimezone(annotations map[string]string) string {
+	if timezone, ok := internal.LookupAnnotation(annotations, internal.InjectedTimezoneAnnotation); ok {
+		return timezone
+	}
+	timezone, _ := internal.LookupAnnotation(annotations, internal.TimezoneAnnotation)
+	return timezone
+}
+
+// StripPodSpec remove TZ env, zoneinfo volume and volume mounts added by PatchGenerator from spec,
+// env vars changed by env templates are restored as recorded in annotations, return true if spec was changed
+func StripPodSpec(spec *corev1.PodSpec, annotations map[string]string) bool {
+	changed := false
+	envs := injectedEnvsOf(spec, annotations)
+
+	volumes := make([]corev1.Volume, 0, len(spec.Volumes))
+	for _, v := range spec.Volumes {
+		if _, ok := injectedVolume(v.Name); ok {
+			changed = true
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+	spec.Volumes = volumes
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+
+		mounts := make([]corev1.VolumeMount, 0, len(c.VolumeMounts))
+		for _, m := range c.VolumeMounts {
+			if _, ok := injectedVolume(m.Name); ok {
+				changed = true
+				continue
+			}
+			mounts = append(mounts, m)
+		}
+		c.VolumeMounts = mounts
+
+		removed, values := strippedEnv(c.Env, envs[c.Name])
+		env := make([]corev1.EnvVar, 0, len(c.Env))
+		for j, e := range c.Env {
+			if value, ok := values[j]; ok {
+				e.Value = value
+				changed = true
+			}
+			if removed[j] {
+				changed = true
+				continue
+			}
+			env = append(env, e)
+		}
+		c.Env = env
+	}
+	return changed
+}
+
+// strippedEnv return the indexes of env vars added by injection and the values of env vars changed by it,
+// as recorded. TZ and env templates are appended to the end of env, so the last one with the name is injected
+func strippedEnv(env []corev1.EnvVar, recorded []injectedEnv) (map[int]bool, map[int]string) {
+	removed, values := map[int]bool{}, map[int]string{}
+	last := func(name string) int {
+		for j := len(env) - 1; j >= 0; j-- {
+			if env[j].Name == name && !removed[j] {
+				return j
+			}
+		}
+		return -1
+	}
+
+	for _, e := range recorded {
+		j := last(e.Name)
+		switch {
+		case j < 0:
+		case e.Added:
+			removed[j] = true
+		case e.Replaced != nil:
+			values[j] = *e.Replaced
+		case e.Appended != "":
+			values[j] = removeEnvWord(env[j].Value, e.Appended)
+		}
+	}
+	return removed, values
+}
+
+// StripNodeSelector remove the node label of hostPath strategy from node selector of spec,
+// return true if spec was changed
+func StripNodeSelector(spec *corev1.PodSpec, nodeLabel string) bool {
+	key, value := ParseNodeLabel(nodeLabel)
+	if v, ok := spec.NodeSelector[key]; key == "" || !ok || v != value {
+		return false
+	}
+	delete(spec.NodeSelector, key)
+	if len(spec.NodeSelector) == 0 {
+		spec.NodeSelector = nil
+	}
+	return true
+}
+
+// Uninjector generate patches which remove a previous injection of PatchGenerator
+type Uninjector struct {
+	// HostPathNodeLabel is removed from node selector, it should be the same as PatchGenerator
+	HostPathNodeLabel string
+}
+
+// Generate ...
+func (u *Uninjector) Generate(ctx context.Context, object interface{}, pathPrefix string) (internal.Patches, error) {
+	switch o := object.(type) {
+	case *appsv1.StatefulSet:
+		return u.forPodSpec(&o.Spec.Template.Spec, fmt.Sprintf("%s/spec/template/spec", pathPrefix), map[string]*metav1.ObjectMeta{
+			fmt.Sprintf("%s/metadata", pathPrefix):               &o.ObjectMeta,
+			fmt.Sprintf("%s/spec/template/metadata", pathPrefix): &o.Spec.Template.ObjectMeta,
+		}), nil
+	case *appsv1.Deployment:
+		return u.forPodSpec(&o.Spec.Template.Spec, fmt.Sprintf("%s/spec/template/spec", pathPrefix), map[string]*metav1.ObjectMeta{
+			fmt.Sprintf("%s/metadata", pathPrefix):               &o.ObjectMeta,
+			fmt.Sprintf("%s/spec/template/metadata", pathPrefix): &o.Spec.Template.ObjectMeta,
+		}), nil
+	case *corev1.Pod:
+		return u.forPodSpec(&o.Spec, fmt.Sprintf("%s/spec", pathPrefix), map[string]*metav1.ObjectMeta{
+			fmt.Sprintf("%s/metadata", pathPrefix): &o.ObjectMeta,
+		}), nil
+	case *corev1.List:
+		return generateList(ctx, u, o, pathPrefix)
+	}
+
+	return make(internal.Patches, 0), fmt.Errorf("not injectable object: %T", object)
+}
+
+// forPodSpec only strip objects marked by internal.InjectedAnnotation
+func (u *Uninjector) forPodSpec(spec *corev1.PodSpec, pathPrefix string, postInjectionAnnotations map[string]*metav1.ObjectMeta) internal.Patches {
+	injected := false
+	for _, meta := range postInjectionAnnotations {
+		if _, ok := internal.LookupAnnotation(meta.Annotations, internal.InjectedAnnotation); ok {
+			injected = true
+		}
+	}
+	if !injected {
+		return internal.Patches{}
+	}
+
+	var envs injectedEnvs
+	for _, k := range sortedKeys(postInjectionAnnotations) {
+		if envs = parseInjectedEnvs(postInjectionAnnotations[k].Annotations); envs != nil {
+			break
+		}
+	}
+	if envs == nil {
+		envs = legacyInjectedEnvs(spec)
+	}
+	patches := stripPodSpecPatches(spec, pathPrefix, envs)
+	if key, value := ParseNodeLabel(u.HostPathNodeLabel); key != "" && InjectedStrategy(spec) == HostPathInjectionStrategy {
+		if v, ok := spec.NodeSelector[key]; ok && v == value {
+			path := fmt.Sprintf("%s/nodeSelector", pathPrefix)
+			if len(spec.NodeSelector) > 1 {
+				path = fmt.Sprintf("%s/%s", path, escapeJSONPointer(key))
+			}
+			patches = append(patches, internal.Patch{Op: "remove", Path: path})
+		}
+	}
+	for _, k := range sortedKeys(postInjectionAnnotations) {
+		patches = append(patches, removePostInjectionAnnotations(postInjectionAnnotations[k], k)...)
+	}
+	return patches
+}
+
+// stripPodSpecPatches is the same as StripPodSpec but return patches, values are replaced before indexes
+// are removed from the end so every patch stays valid after the previous one applied
+func stripPodSpecPatches(spec *corev1.PodSpec, pathPrefix string, envs injectedEnvs) internal.Patches {
+	var patches = internal.Patches{}
+	for containerID, c := range spec.Containers {
+		removed, values := strippedEnv(c.Env, envs[c.Name])
+		for j := range c.Env {
+			if value, ok := values[j]; ok && !removed[j] {
+				patches = append(patches, internal.Patch{
+					Op:    "replace",
+					Path:  fmt.Sprintf("%s/containers/%d/env/%d/value", pathPrefix, containerID, j),
+					Value: value,
+				})
+			}
+		}
+		patches = append(patches, removeIndexes(fmt.Sprintf("%s/containers/%d/env", pathPrefix, containerID), len(c.Env), func(j int) bool {
+			return removed[j]
+		})...)
+		patches = append(patches, removeIndexes(fmt.Sprintf("%s/containers/%d/volumeMounts", pathPrefix, containerID), len(c.VolumeMounts), func(j int) bool {
+			_, ok := injectedVolume(c.VolumeMounts[j].Name)
+			return ok
+		})...)
+	}
+	patches = append(patches, removeIndexes(fmt.Sprintf("%s/volumes", pathPrefix), len(spec.Volumes), func(j int) bool {
+		_, ok := injectedVolume(spec.Volumes[j].Name)
+		return ok
+	})...)
+	return patches
+}
+
+// removeIndexes remove every index of the list at path matching remove,
+// the whole list is removed when no element left
+func removeIndexes(path string, length int, remove func(int) bool) internal.Patches {
+	var patches = internal.Patches{}
+	for j := length - 1; j >= 0; j-- {
+		if remove(j) {
+			patches = append(patches, internal.Patch{
+				Op:   "remove",
+				Path: fmt.Sprintf("%s/%d", path, j),
+			})
+		}
+	}
+	if length > 0 && len(patches) == length {
+		return internal.Patches{{Op: "remove", Path: path}}
+	}
+	return patches
+}
+
+// removePostInjectionAnnotations remove the annotations written by injection under every prefix: the injected
+// marker and the records of timezone and env vars. Annotations set by user, e.g. timezone, are kept
+func removePostInjectionAnnotations(meta *metav1.ObjectMeta, pathPrefix string) internal.Patches {
+	var patches = internal.Patches{}
+	for _, key := range sortedAnnotationKeys(meta.Annotations) {
+		if isPostInjectionAnnotation(key) {
+			patches = append(patches, internal.Patch{
+				Op:   "remove",
+				Path: fmt.Sprintf("%s/annotations/%s", pathPrefix, escapeJSONPointer(key)),
+			})
+		}
+	}
+	if len(patches) > 0 && len(patches) == len(meta.Annotations) {
+		return internal.Patches{{Op: "remove", Path: fmt.Sprintf("%s/annotations", pathPrefix)}}
+	}
+	return patches
+}
+
+// isPostInjectionAnnotation report whether key is written by injection under any prefix
+func isPostInjectionAnnotation(key string) bool {
+	for _, prefix := range internal.AnnotationPrefixes() {
+		name := strings.TrimPrefix(key, prefix+"/")
+		if name == key {
+			continue
+		}
+		switch {
+		case name == internal.AnnotationName(internal.InjectedAnnotation),
+			name == internal.AnnotationName(internal.InjectedTimezoneAnnotation),
+			name == internal.AnnotationName(internal.InjectedEnvAnnotation),
+			strings.HasPrefix(name, internal.AnnotationName(internal.InjectedContainerTimezoneAnnotationPrefix)):
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]*metav1.ObjectMeta) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,189 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// applyGenerator decode document, apply patches of g and return the result as json
+func applyGenerator(t *testing.T, g Generator, document string) string {
+	data, err := yamlconvert.YAMLToJSON([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := DecodeObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := g.Generate(context.TODO(), obj, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchJSON, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = patch.Apply(data); err != nil {
+		t.Fatalf("failed to apply %s: %v", patchJSON, err)
+	}
+	return normalizeJSON(t, data)
+}
+
+// normalizeJSON return data with sorted keys
+func normalizeJSON(t *testing.T, data []byte) string {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// documentJSON return yaml document as normalized json
+func documentJSON(t *testing.T, document string) string {
+	data, err := yamlconvert.YAMLToJSON([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return normalizeJSON(t, data)
+}
+
+const annotatedDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    timezone.jugglechat.io/timezone: Europe/Paris
+    team: billing
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: app
+`
+
+const plainPod = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  containers:
+  - name: app
+    image: app
+`
+
+const javaDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: app
+        env:
+        - name: JAVA_TOOL_OPTIONS
+          value: -Xmx1g
+      - name: sidecar
+        image: sidecar
+`
+
+// TestUninjectRoundTrip check uninject restore the original object and keep annotations set by user
+func TestUninjectRoundTrip(t *testing.T) {
+	cases := []struct {
+		name         string
+		document     string
+		envTemplates []string
+	}{
+		{name: "user annotations", document: annotatedDeployment},
+		{name: "no annotations", document: plainPod},
+		{name: "env templates", document: javaDeployment, envTemplates: []string{"java", "locale"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			injector := &AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true, EnvTemplateNames: c.envTemplates}
+			injected := applyGenerator(t, injector, c.document)
+			if injected == documentJSON(t, c.document) {
+				t.Fatal("expected document injected")
+			}
+			if stripped := applyGenerator(t, &Uninjector{}, injected); stripped != documentJSON(t, c.document) {
+				t.Fatalf("expected uninject restore the original\nexpected: %s\ngot:      %s", documentJSON(t, c.document), stripped)
+			}
+		})
+	}
+}
+
+// addContainer add a container to the pod template of deployment json
+func addContainer(t *testing.T, document string, container map[string]interface{}) string {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(document), &obj); err != nil {
+		t.Fatal(err)
+	}
+	spec := obj["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	spec["containers"] = append(spec["containers"].([]interface{}), container)
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return normalizeJSON(t, data)
+}
+
+// TestUninjectKeepsContainerNotInjected check uninject only strip the containers recorded by injection,
+// TZ of a container added after injection is set by user
+func TestUninjectKeepsContainerNotInjected(t *testing.T) {
+	debug := map[string]interface{}{"name": "debug", "image": "debug", "env": []interface{}{
+		map[string]interface{}{"name": TZEnvName, "value": "UTC"},
+	}}
+	injector := &AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	injected := addContainer(t, applyGenerator(t, injector, javaDeployment), debug)
+
+	expected := addContainer(t, documentJSON(t, javaDeployment), debug)
+	if stripped := applyGenerator(t, &Uninjector{}, injected); stripped != expected {
+		t.Fatalf("expected TZ of debug container kept\nexpected: %s\ngot:      %s", expected, stripped)
+	}
+}
+
+// TestLegacyAnnotationPrefix check an object injected under a prefix which became legacy is still recognized,
+// its annotations are read and uninject strip the post-injection annotations under it
+func TestLegacyAnnotationPrefix(t *testing.T) {
+	defer internal.SetAnnotationPrefixes(nil) //nolint:errcheck
+	injector := &AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	injected := applyGenerator(t, injector, annotatedDeployment)
+
+	if err := internal.SetAnnotationPrefixes([]string{"tz.example.com", internal.DefaultAnnotationPrefix}); err != nil {
+		t.Fatal(err)
+	}
+	decision := injector.Decide(map[string]string{internal.DefaultAnnotationPrefix + "/timezone": "Europe/Paris"}, nil, nil, &corev1.PodSpec{})
+	if decision.Generator == nil || decision.Generator.Timezone != "Europe/Paris" {
+		t.Fatalf("expected timezone read under legacy prefix, got %+v", decision)
+	}
+	if reinjected := applyGenerator(t, injector, injected); reinjected != injected {
+		t.Fatalf("expected object injected under legacy prefix skipped, got %s", reinjected)
+	}
+	if stripped := applyGenerator(t, &Uninjector{}, injected); stripped != documentJSON(t, annotatedDeployment) {
+		t.Fatalf("expected uninject strip annotations under legacy prefix\nexpected: %s\ngot:      %s", documentJSON(t, annotatedDeployment), stripped)
+	}
+}
@@ -0,0 +1,104 @@
+package inject
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/m198799/timezone-webhook/internal"
+)
+
+// TopologySource is the region or zone a pod is pinned to by node selector or node affinity
+const TopologySource Source = "topology"
+
+// topologyLabels are consulted in order, zone is more specific than region
+var topologyLabels = []string{corev1.LabelTopologyZone, corev1.LabelTopologyRegion}
+
+// resolveTimezone return the timezone of object, first from object annotation, second from the
+// region or zone the pod is pinned to, three from label rules matching pod labels, four from namespace
+// annotation, five from region annotation of object or namespace, six from default value. Regions
+// are mapped by RegionTimezones
+func (g *AnnotatedGenerator) resolveTimezone(decision *Decision, annotations, namespaceAnnotations, podLabels map[string]string, spec *corev1.PodSpec) string {
+	timezone, source := lookupAnnotation(internal.TimezoneAnnotation, annotations, namespaceAnnotations)
+	if source == ObjectSource {
+		decision.rule(internal.TimezoneAnnotation, source, timezone)
+		return timezone
+	}
+
+	if len(g.RegionTimezones) > 0 {
+		if label, value, ok := pinnedTopology(spec); ok {
+			decision.rule(label, TopologySource, value)
+			if mapped, ok := g.RegionTimezones[value]; ok {
+				decision.rule(internal.TimezoneAnnotation, TopologySource, mapped)
+				return mapped
+			}
+			decision.Warnings = append(decision.Warnings, fmt.Sprintf("pod is pinned to %s=%s which has no timezone in region map", label, value))
+		}
+	}
+
+	if rule, ok := g.labelTimezone(podLabels); ok {
+		decision.rule(rule.Selector.String(), LabelSource, rule.Timezone)
+		decision.rule(internal.TimezoneAnnotation, LabelSource, rule.Timezone)
+		return rule.Timezone
+	}
+
+	if source == NamespaceSource {
+		decision.rule(internal.TimezoneAnnotation, source, timezone)
+		return timezone
+	}
+
+	if len(g.RegionTimezones) > 0 {
+		if region, source := lookupAnnotation(internal.RegionAnnotation, annotations, namespaceAnnotations); source != NoSource {
+			decision.rule(internal.RegionAnnotation, source, region)
+			if mapped, ok := g.RegionTimezones[region]; ok {
+				decision.rule(internal.TimezoneAnnotation, source, mapped)
+				return mapped
+			}
+			decision.Warnings = append(decision.Warnings, fmt.Sprintf("region %q of %s has no timezone in region map", region, source))
+		}
+	}
+
+	decision.rule(internal.TimezoneAnnotation, DefaultSource, g.Timezone)
+	return g.Timezone
+}
+
+// pinnedTopology return the zone or region pod is pinned to by node selector or required node affinity
+func pinnedTopology(spec *corev1.PodSpec) (string, string, bool) {
+	if spec == nil {
+		return "", "", false
+	}
+	for _, label := range topologyLabels {
+		if value, ok := spec.NodeSelector[label]; ok {
+			return label, value, true
+		}
+	}
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil || spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return "", "", false
+	}
+
+	terms := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, label := range topologyLabels {
+		if value, ok := pinnedByTerms(terms, label); ok {
+			return label, value, true
+		}
+	}
+	return "", "", false
+}
+
+// pinnedByTerms return the value when every term requires label in a single value, terms are ORed
+func pinnedByTerms(terms []corev1.NodeSelectorTerm, label string) (string, bool) {
+	pinned := ""
+	for _, term := range terms {
+		value := ""
+		for _, expr := range term.MatchExpressions {
+			if expr.Key == label && expr.Operator == corev1.NodeSelectorOpIn && len(expr.Values) == 1 {
+				value = expr.Values[0]
+			}
+		}
+		if value == "" || (pinned != "" && pinned != value) {
+			return "", false
+		}
+		pinned = value
+	}
+	return pinned, pinned != ""
+}
@@ -2,20 +2,48 @@
 package inject
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	yamlconvert "sigs.k8s.io/yaml"
+
+	"github.com/m198799/timezone-webhook/internal"
 )
 
 const readerSize = 4096
 
+// OutputFormat is the output format of Transformer
+type OutputFormat string
+
+const (
+	// YAMLOutputFormat write the patched objects as yaml
+	YAMLOutputFormat OutputFormat = "yaml"
+	// JSONOutputFormat write the patched objects as json, one object per line
+	JSONOutputFormat OutputFormat = "json"
+	// PatchOutputFormat write a kustomize patch with RFC 6902 json patch and target per object
+	PatchOutputFormat OutputFormat = "patch"
+	// StrategicMergeOutputFormat write a kustomize strategic-merge patch per object
+	StrategicMergeOutputFormat OutputFormat = "strategic-merge"
+
+	// DefaultOutputFormat is used for yaml inputs when no format specified,
+	// json inputs are written as json in the same layout
+	DefaultOutputFormat = YAMLOutputFormat
+)
+
+// jsonIndent is the indent of json objects and arrays, the same as kubectl
+const jsonIndent = "    "
+
 // Inputs Input slice
 type Inputs []Input
 
@@ -24,59 +52,86 @@ type Input struct {
 	ArgNumber  int
 	Identifier string
 	Reader     io.Reader
+	// RelativePath is the path of input inside OutputDir
+	RelativePath string
 }
 
 // Transformer ...
 type Transformer struct {
-	PatchGenerator PatchGenerator
-	Inputs         Inputs
-	Output         io.Writer
-}
-
-// ArgumentsToInputs ...
-func ArgumentsToInputs(args []string) (Inputs, error) {
-	inputs := Inputs{}
-	for i, arg := range args {
-		if arg == "-" {
-			input := Input{
-				ArgNumber:  i,
-				Identifier: arg,
-				Reader:     os.Stdin,
-			}
-			inputs = append(inputs, input)
-			continue
-		}
+	Generator Generator
+	Inputs    Inputs
+	Output    io.Writer
+	Format    OutputFormat
+	// InPlace rewrite every input file instead of writing to Output
+	InPlace bool
+	// PreserveFormatting keep comments, key order and formatting of yaml output,
+	// only the injected nodes are written
+	PreserveFormatting bool
+	// OutputDir write every input to its RelativePath in the directory instead of writing to Output
+	OutputDir string
+	// Report receive the result of every input, nil disable the report
+	Report io.Writer
+}
 
-		file, err := os.Open(arg)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open input(%d): %s, error: %w", i, arg, err)
-		}
+// inputResult is the result of transforming an input
+type inputResult struct {
+	documents int
+	patched   int
+}
 
-		input := Input{
-			ArgNumber:  i,
-			Identifier: arg,
-			Reader:     file,
-		}
-		inputs = append(inputs, input)
-	}
+// kustomizePatch is an entry of kustomization patches field
+type kustomizePatch struct {
+	Target kustomizeTarget `json:"target"`
+	Patch  string          `json:"patch"`
+}
+
+// kustomizeTarget select the object kustomizePatch applied to
+type kustomizeTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
 
-	return inputs, nil
+// documentWriter write documents to writer with separator of format
+type documentWriter struct {
+	writer io.Writer
+	// configured is the format requested by user, empty follow the input
+	configured OutputFormat
+	// format is the format of current input
+	format OutputFormat
+	stream streamFormat
+	first  bool
+	// array collect documents of json array input
+	array []json.RawMessage
+}
+
+// ParseOutputFormat check format is a known OutputFormat
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch f := OutputFormat(format); f {
+	case YAMLOutputFormat, JSONOutputFormat, PatchOutputFormat, StrategicMergeOutputFormat:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q, must be one of %s, %s, %s, %s", format,
+		YAMLOutputFormat, JSONOutputFormat, PatchOutputFormat, StrategicMergeOutputFormat)
 }
 
 // Transform ...
 func (t *Transformer) Transform() error {
-	first := true
-	for _, v := range t.Inputs {
-		if !first {
-			_, err := t.Output.Write([]byte("---\n"))
-			if err != nil {
-				return fmt.Errorf("failed to write to standard output stream, error: %v", err)
-			}
-		}
+	format, err := t.format()
+	if err != nil {
+		return err
+	}
 
-		first = false
-		err := t.transformInput(v)
+	if t.InPlace || t.OutputDir != "" {
+		return t.transformToFiles(format)
+	}
 
+	out := &documentWriter{writer: t.Output, configured: format, first: true}
+	for _, v := range t.Inputs {
+		result, err := t.transformReader(v, out)
+		t.report(v, result, err)
 		if err != nil {
 			return fmt.Errorf("transformation failed for input: %s(%d), error: %w", v.Identifier, v.ArgNumber, err)
 		}
@@ -85,91 +140,371 @@ func (t *Transformer) Transform() error {
 	return nil
 }
 
-func (t *Transformer) transformInput(input Input) error {
-	reader := yaml.NewYAMLReader(bufio.NewReaderSize(input.Reader, readerSize))
+// format return the output format, empty means the same as every input
+func (t *Transformer) format() (OutputFormat, error) {
+	if t.Format == "" {
+		return "", nil
+	}
+	return ParseOutputFormat(string(t.Format))
+}
 
-	first := true
-	for {
-		bytes, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
+// transformToFiles transform every input to a buffer and write it to the input file itself
+// or to OutputDir, all inputs are processed and failures are reported at the end
+func (t *Transformer) transformToFiles(format OutputFormat) error {
+	if t.InPlace && t.OutputDir != "" {
+		return errors.New("in-place editing and output directory could not be used together")
+	}
+	if t.InPlace && format != "" && format != YAMLOutputFormat && format != JSONOutputFormat {
+		return fmt.Errorf("in-place editing does not support output format %s", format)
+	}
+
+	failed := 0
+	for _, v := range t.Inputs {
+		result, err := t.transformToFile(v, format)
+		t.report(v, result, err)
 		if err != nil {
-			return err
+			failed++
 		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("transformation failed for %d of %d inputs", failed, len(t.Inputs))
+	}
+	return nil
+}
 
+func (t *Transformer) transformToFile(input Input, format OutputFormat) (inputResult, error) {
+	if input.Identifier == "-" {
+		return inputResult{}, errors.New("writing to files does not support standard input")
+	}
+
+	buf := &bytes.Buffer{}
+	result, err := t.transformReader(input, &documentWriter{writer: buf, configured: format, first: true})
+	if err != nil {
+		return result, err
+	}
+
+	target, perm := input.Identifier, os.FileMode(0o644)
+	if info, err := os.Stat(input.Identifier); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if t.OutputDir != "" {
+		rel := input.RelativePath
+		if rel == "" {
+			rel = filepath.Base(input.Identifier)
+		}
+		target = filepath.Join(t.OutputDir, rel)
+		if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return result, err
+		}
+	}
+	if err = os.WriteFile(target, buf.Bytes(), perm); err != nil {
+		return result, fmt.Errorf("failed to write %s, error: %w", target, err)
+	}
+	return result, nil
+}
+
+// transformReader open input, transform it and close it
+func (t *Transformer) transformReader(input Input, out *documentWriter) (inputResult, error) {
+	reader, err := input.open()
+	if err != nil {
+		return inputResult{}, err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	input.Reader = reader
+	return t.transformInput(input, out)
+}
+
+// report write the result of input to Report
+func (t *Transformer) report(input Input, result inputResult, err error) {
+	if t.Report == nil {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(t.Report, "failed\t%s\t%v\n", input.Identifier, err)
+		return
+	}
+	fmt.Fprintf(t.Report, "ok\t%s\t%d documents, %d patched\n", input.Identifier, result.documents, result.patched)
+}
+
+func (t *Transformer) transformInput(input Input, out *documentWriter) (inputResult, error) {
+	var result inputResult
+	documents, stream, err := readDocuments(input.Reader)
+	if err != nil {
+		return result, err
+	}
+	out.begin(stream)
+
+	for _, bytes := range documents {
 		obj, err := parseTypeMetaSkeleton(bytes)
 		if err != nil {
-			return err
+			return result, err
 		}
 
 		if obj == nil {
-			if !first {
-				_, err = t.Output.Write([]byte("---\n"))
-				if err != nil {
-					return fmt.Errorf("failed to write to standard output stream, error: %v", err)
-				}
-			}
-
-			_, err = t.Output.Write(bytes)
-			if err != nil {
-				return fmt.Errorf("failed to write to standard output stream, error: %v", err)
-			}
-
-			first = false
 			fmt.Fprintf(os.Stderr, "unknown TypeMeta in input: (%d)%s, writing to output as-is\n", input.ArgNumber, input.Identifier)
+			if err = out.writeUnknown(bytes); err != nil {
+				return result, err
+			}
 			continue
 		}
 
 		err = yaml.Unmarshal(bytes, obj)
 		if err != nil {
-			return err
+			return result, err
 		}
 
-		patchObj, err := t.PatchGenerator.Generate(context.TODO(), obj, "")
+		patchObj, err := t.Generator.Generate(context.TODO(), obj, "")
 		if err != nil {
-			return fmt.Errorf("failed to generate patch for kind: %T, error: %w", obj, err)
+			return result, fmt.Errorf("failed to generate patch for kind: %T, error: %w", obj, err)
+		}
+		result.documents++
+		if len(patchObj) > 0 {
+			result.patched++
 		}
 
-		patchJSON, err := json.Marshal(patchObj)
+		origJSON, err := yamlconvert.YAMLToJSON(bytes)
 		if err != nil {
-			return err
+			return result, err
 		}
 
-		patch, err := jsonpatch.DecodePatch(patchJSON)
+		if out.format == PatchOutputFormat {
+			if err = out.writePatch(origJSON, patchObj); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		patchJSON, err := json.Marshal(patchObj)
 		if err != nil {
-			return err
+			return result, err
 		}
 
-		origJSON, err := yamlconvert.YAMLToJSON(bytes)
+		patch, err := jsonpatch.DecodePatch(patchJSON)
 		if err != nil {
-			return err
+			return result, err
 		}
 
 		injectedJSON, err := patch.Apply(origJSON)
 		if err != nil {
-			return err
+			return result, err
 		}
 
-		injectedYAML, err := yamlconvert.JSONToYAML(injectedJSON)
-		if err != nil {
-			return err
+		if out.format == StrategicMergeOutputFormat {
+			if err = out.writeStrategicMerge(origJSON, injectedJSON, obj); err != nil {
+				return result, err
+			}
+			continue
 		}
 
-		if !first {
-			_, err = t.Output.Write([]byte("---\n"))
-			if err != nil {
-				return fmt.Errorf("failed to write to standard output stream, error: %v", err)
+		if out.format == YAMLOutputFormat && stream == yamlStream && t.PreserveFormatting {
+			if err = out.writePreserved(bytes, patchObj, injectedJSON, input); err != nil {
+				return result, err
 			}
+			continue
 		}
 
-		_, err = t.Output.Write(injectedYAML)
-		if err != nil {
+		if err = out.writeJSON(injectedJSON); err != nil {
+			return result, err
+		}
+	}
+
+	return result, out.end()
+}
+
+// begin set the format of the next input, json inputs are written as json by default
+func (w *documentWriter) begin(stream streamFormat) {
+	w.stream = stream
+	w.format = w.configured
+	if w.format == "" && stream != yamlStream {
+		w.format = JSONOutputFormat
+	} else if w.format == "" {
+		w.format = DefaultOutputFormat
+	}
+}
+
+// end write the collected documents of json array input
+func (w *documentWriter) end() error {
+	if w.format != JSONOutputFormat || w.stream != jsonArray {
+		return nil
+	}
+	array := w.array
+	if array == nil {
+		array = []json.RawMessage{}
+	}
+	w.array = nil
+
+	data, err := json.Marshal(array)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err = json.Indent(buf, data, "", jsonIndent); err != nil {
+		return err
+	}
+	return w.emit(buf.Bytes())
+}
+
+// write a document, documents are separated by "---" except json format,
+// json object input is indented and json array input is collected until end
+func (w *documentWriter) write(document []byte) error {
+	if w.format == JSONOutputFormat {
+		switch w.stream {
+		case jsonArray:
+			w.array = append(w.array, json.RawMessage(bytes.TrimSpace(document)))
+			return nil
+		case jsonObject:
+			buf := &bytes.Buffer{}
+			if err := json.Indent(buf, document, "", jsonIndent); err != nil {
+				return err
+			}
+			document = buf.Bytes()
+		}
+	}
+	return w.emit(document)
+}
+
+// emit write document with separator
+func (w *documentWriter) emit(document []byte) error {
+	if !w.first && w.format != JSONOutputFormat {
+		if _, err := w.writer.Write([]byte("---\n")); err != nil {
 			return fmt.Errorf("failed to write to standard output stream, error: %v", err)
 		}
+	}
+	w.first = false
+
+	if len(document) > 0 && document[len(document)-1] != '\n' {
+		document = append(document, '\n')
+	}
+	if _, err := w.writer.Write(document); err != nil {
+		return fmt.Errorf("failed to write to standard output stream, error: %v", err)
+	}
+	return nil
+}
+
+// writeJSON write object in json or yaml format
+func (w *documentWriter) writeJSON(data []byte) error {
+	if w.format == JSONOutputFormat {
+		return w.write(data)
+	}
+	document, err := yamlconvert.JSONToYAML(data)
+	if err != nil {
+		return err
+	}
+	return w.write(document)
+}
 
-		first = false
+// writePreserved write yaml document with patches applied on its text, document without
+// patches is written as-is, fallback to re-encoded document when text could not be patched
+func (w *documentWriter) writePreserved(document []byte, patches internal.Patches, injectedJSON []byte, input Input) error {
+	if len(patches) == 0 {
+		return w.write(document)
 	}
+	preserved, err := applyPatchesPreservingFormat(document, patches, injectedJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to preserve formatting in input: (%d)%s, writing re-encoded document, error: %v\n", input.ArgNumber, input.Identifier, err)
+		return w.writeJSON(injectedJSON)
+	}
+	return w.write(preserved)
+}
 
+// writeUnknown write yaml document not injectable as-is, patch formats skip it
+func (w *documentWriter) writeUnknown(document []byte) error {
+	switch w.format {
+	case YAMLOutputFormat:
+		return w.write(document)
+	case JSONOutputFormat:
+		if len(bytes.TrimSpace(document)) == 0 {
+			return nil
+		}
+		data, err := yamlconvert.YAMLToJSON(document)
+		if err != nil {
+			return err
+		}
+		return w.write(data)
+	}
 	return nil
 }
+
+// writePatch write kustomize patch with target, objects without patches are skipped
+func (w *documentWriter) writePatch(origJSON []byte, patches internal.Patches) error {
+	if len(patches) == 0 {
+		return nil
+	}
+
+	meta, err := objectIdentity(origJSON)
+	if err != nil {
+		return err
+	}
+	if meta.Kind == "List" {
+		return errors.New("patch output format does not support List")
+	}
+	patchYAML, err := yamlconvert.Marshal(patches)
+	if err != nil {
+		return err
+	}
+
+	gv := strings.SplitN(meta.APIVersion, "/", 2)
+	target := kustomizeTarget{Version: gv[0], Kind: meta.Kind, Name: meta.Name, Namespace: meta.Namespace}
+	if len(gv) == 2 {
+		target.Group, target.Version = gv[0], gv[1]
+	}
+
+	document, err := yamlconvert.Marshal(kustomizePatch{Target: target, Patch: string(patchYAML)})
+	if err != nil {
+		return err
+	}
+	return w.write(document)
+}
+
+// writeStrategicMerge write strategic-merge patch between original and injected object,
+// apiVersion, kind, name and namespace are kept so kustomize could find the object
+func (w *documentWriter) writeStrategicMerge(origJSON, injectedJSON []byte, obj interface{}) error {
+	meta, err := objectIdentity(origJSON)
+	if err != nil {
+		return err
+	}
+	if meta.Kind == "List" {
+		return errors.New("strategic-merge output format does not support List")
+	}
+
+	patchJSON, err := strategicpatch.CreateTwoWayMergePatch(origJSON, injectedJSON, obj)
+	if err != nil {
+		return fmt.Errorf("failed to create strategic merge patch, error: %w", err)
+	}
+
+	patch := map[string]interface{}{}
+	if err = json.Unmarshal(patchJSON, &patch); err != nil {
+		return err
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+
+	metadata, _ := patch["metadata"].(map[string]interface{}) //nolint:errcheck
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["name"] = meta.Name
+	if meta.Namespace != "" {
+		metadata["namespace"] = meta.Namespace
+	}
+	patch["metadata"] = metadata
+	patch["apiVersion"] = meta.APIVersion
+	patch["kind"] = meta.Kind
+
+	document, err := yamlconvert.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return w.write(document)
+}
+
+// objectIdentity read TypeMeta and ObjectMeta of object
+func objectIdentity(data []byte) (*metav1.PartialObjectMetadata, error) {
+	meta := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,135 @@
+package inject
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	yamlconvert "sigs.k8s.io/yaml"
+)
+
+const namespacedDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: shop
+spec:
+  template:
+    metadata:
+      labels: {app: app}
+    spec:
+      containers:
+      - name: app
+        image: app
+`
+
+// transform run Transformer of the inject command with format on document and return the output
+func transform(t *testing.T, format OutputFormat, document string) string {
+	g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	out := &bytes.Buffer{}
+	transformer := Transformer{
+		Generator: &g,
+		Inputs:    Inputs{{Identifier: "-", Reader: strings.NewReader(document)}},
+		Output:    out,
+		Format:    format,
+	}
+	if err := transformer.Transform(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+// TestPatchOutputFormat check the kustomize patch targets the object and applies to the injected object
+func TestPatchOutputFormat(t *testing.T) {
+	g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	injected := applyGenerator(t, &g, namespacedDeployment)
+
+	patch := kustomizePatch{}
+	if err := yamlconvert.Unmarshal([]byte(transform(t, PatchOutputFormat, namespacedDeployment)), &patch); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (kustomizeTarget{Group: "apps", Version: "v1", Kind: "Deployment", Name: "app", Namespace: "shop"}); patch.Target != expected {
+		t.Fatalf("expected target %+v, got %+v", expected, patch.Target)
+	}
+	patchJSON, err := yamlconvert.YAMLToJSON([]byte(patch.Patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := decoded.Apply([]byte(documentJSON(t, namespacedDeployment)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalizeJSON(t, patched) != injected {
+		t.Fatalf("expected patch output to inject the object\nexpected: %s\ngot:      %s", injected, patched)
+	}
+
+	if output := transform(t, PatchOutputFormat, transform(t, YAMLOutputFormat, namespacedDeployment)); output != "" {
+		t.Fatalf("expected no patch for injected object, got %s", output)
+	}
+}
+
+// TestStrategicMergeOutputFormat check the strategic-merge patch keeps identity and merges to the injected object
+func TestStrategicMergeOutputFormat(t *testing.T) {
+	g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	injected := applyGenerator(t, &g, namespacedDeployment)
+
+	patchJSON, err := yamlconvert.YAMLToJSON([]byte(transform(t, StrategicMergeOutputFormat, namespacedDeployment)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := map[string]interface{}{}
+	if err = json.Unmarshal(patchJSON, &patch); err != nil {
+		t.Fatal(err)
+	}
+	metadata, _ := patch["metadata"].(map[string]interface{}) //nolint:errcheck
+	if patch["apiVersion"] != "apps/v1" || patch["kind"] != "Deployment" || metadata["name"] != "app" || metadata["namespace"] != "shop" {
+		t.Fatalf("expected identity of object kept, got %s", patchJSON)
+	}
+	merged, err := strategicpatch.StrategicMergePatch([]byte(documentJSON(t, namespacedDeployment)), patchJSON, &appsv1.Deployment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalizeJSON(t, merged) != injected {
+		t.Fatalf("expected strategic-merge output to inject the object\nexpected: %s\ngot:      %s", injected, merged)
+	}
+
+	if output := transform(t, StrategicMergeOutputFormat, transform(t, YAMLOutputFormat, namespacedDeployment)); output != "" {
+		t.Fatalf("expected no patch for injected object, got %s", output)
+	}
+}
+
+// TestInPlace check in-place editing rewrite the input file and reject patch formats
+func TestInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(namespacedDeployment), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	g := AnnotatedGenerator{PatchGenerator: NewPatchGenerator(), InjectByDefault: true}
+	transformer := Transformer{Generator: &g, Inputs: Inputs{{Identifier: path}}, InPlace: true}
+	if err := transformer.Transform(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if documentJSON(t, string(data)) != applyGenerator(t, &g, namespacedDeployment) {
+		t.Fatalf("expected file injected in place, got %s", data)
+	}
+
+	transformer.Format = PatchOutputFormat
+	if err = transformer.Transform(); err == nil {
+		t.Fatal("expected in-place editing reject patch output format")
+	}
+}
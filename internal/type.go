@@ -1,22 +1,142 @@
 // Package internal ...
 package internal
 
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
 const (
 	// DefaultTimezone represents the default timezone for webhook applications
 	DefaultTimezone = CSTTimezone
 	// CSTTimezone is TZ database name for CST timezone
 	CSTTimezone = "Asia/Shanghai"
 
+	// DefaultAnnotationPrefix is the prefix of annotations if not configured
+	DefaultAnnotationPrefix = "timezone.jugglechat.io"
+)
+
+// annotation keys are under the primary prefix, they are set by SetAnnotationPrefixes
+var (
 	// InjectedAnnotation 记录是否已经注入时区，只有在第一次注入的时候回写这个 annotation
-	InjectedAnnotation = "timezone.jugglechat.io/injected"
+	InjectedAnnotation string
 	// TimezoneAnnotation is set user timezone
-	TimezoneAnnotation = "timezone.jugglechat.io/timezone"
+	TimezoneAnnotation string
 	// InjectionStrategyAnnotation set injection strategy
-	InjectionStrategyAnnotation = "timezone.jugglechat.io/strategy"
+	InjectionStrategyAnnotation string
 	// InjectAnnotation set inject
-	InjectAnnotation = "timezone.jugglechat.io/inject"
+	InjectAnnotation string
+	// ContainerTimezoneAnnotationPrefix is followed by container name to set timezone of a container,
+	// e.g. timezone.jugglechat.io/timezone.istio-proxy: UTC
+	ContainerTimezoneAnnotationPrefix string
+	// RegionAnnotation set the region of object or namespace, it is mapped to timezone by region map
+	RegionAnnotation string
+	// EnvTemplatesAnnotation select env templates injected besides TZ, e.g. java,locale or none
+	EnvTemplatesAnnotation string
+	// InjectedTimezoneAnnotation record the timezone injected into pod, annotations set by user such as
+	// TimezoneAnnotation are never written by injection
+	InjectedTimezoneAnnotation string
+	// InjectedContainerTimezoneAnnotationPrefix is followed by container name to record the timezone
+	// injected into a container when it is not the timezone of pod
+	InjectedContainerTimezoneAnnotationPrefix string
+	// InjectedEnvAnnotation record the env vars added or changed by injection per container as json,
+	// TZ and env templates, uninject and re-render strip only them
+	InjectedEnvAnnotation string
+
+	// annotationPrefix is the primary prefix, post-injection annotations are written under it
+	annotationPrefix string
+	// legacyAnnotationPrefixes are still honored when reading annotations, e.g. during migration
+	legacyAnnotationPrefixes []string
 )
 
+func init() {
+	_ = SetAnnotationPrefixes(nil)
+}
+
+// SetAnnotationPrefixes set the prefix of annotation keys, the first one is primary and the others are
+// legacy prefixes only read. DefaultAnnotationPrefix is used if prefixes is empty
+func SetAnnotationPrefixes(prefixes []string) error {
+	if len(prefixes) == 0 {
+		prefixes = []string{DefaultAnnotationPrefix}
+	}
+	seen := map[string]bool{}
+	for _, prefix := range prefixes {
+		if errs := validation.IsDNS1123Subdomain(prefix); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation prefix %q: %s", prefix, strings.Join(errs, ", "))
+		}
+		if seen[prefix] {
+			return fmt.Errorf("duplicate annotation prefix %q", prefix)
+		}
+		seen[prefix] = true
+	}
+
+	annotationPrefix, legacyAnnotationPrefixes = prefixes[0], prefixes[1:]
+	InjectedAnnotation = annotationPrefix + "/injected"
+	TimezoneAnnotation = annotationPrefix + "/timezone"
+	InjectionStrategyAnnotation = annotationPrefix + "/strategy"
+	InjectAnnotation = annotationPrefix + "/inject"
+	ContainerTimezoneAnnotationPrefix = TimezoneAnnotation + "."
+	RegionAnnotation = annotationPrefix + "/region"
+	EnvTemplatesAnnotation = annotationPrefix + "/env-templates"
+	InjectedTimezoneAnnotation = annotationPrefix + "/injected-timezone"
+	InjectedContainerTimezoneAnnotationPrefix = InjectedTimezoneAnnotation + "."
+	InjectedEnvAnnotation = annotationPrefix + "/injected-env"
+	return nil
+}
+
+// AnnotationPrefixes return the primary prefix followed by legacy prefixes
+func AnnotationPrefixes() []string {
+	return append([]string{annotationPrefix}, legacyAnnotationPrefixes...)
+}
+
+// AnnotationName return key relative to the primary prefix, e.g. timezone
+func AnnotationName(key string) string {
+	return strings.TrimPrefix(key, annotationPrefix+"/")
+}
+
+// AnnotationAliases return key under the primary prefix followed by the same key under legacy prefixes
+func AnnotationAliases(key string) []string {
+	aliases := []string{key}
+	if name := strings.TrimPrefix(key, annotationPrefix+"/"); name != key {
+		for _, prefix := range legacyAnnotationPrefixes {
+			aliases = append(aliases, prefix+"/"+name)
+		}
+	}
+	return aliases
+}
+
+// LookupAnnotation read key from annotations, key under legacy prefixes is read if the primary one not set
+func LookupAnnotation(annotations map[string]string, key string) (string, bool) {
+	for _, alias := range AnnotationAliases(key) {
+		if value, ok := annotations[alias]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// NormalizeAnnotations return annotations with keys under legacy prefixes renamed to the primary prefix,
+// the primary one wins and an earlier legacy prefix wins over a later one
+func NormalizeAnnotations(annotations map[string]string) map[string]string {
+	if len(legacyAnnotationPrefixes) == 0 || len(annotations) == 0 {
+		return annotations
+	}
+	normalized := make(map[string]string, len(annotations))
+	for i := len(legacyAnnotationPrefixes) - 1; i >= 0; i-- {
+		for k, v := range annotations {
+			if name := strings.TrimPrefix(k, legacyAnnotationPrefixes[i]+"/"); name != k {
+				normalized[annotationPrefix+"/"+name] = v
+			}
+		}
+	}
+	for k, v := range annotations {
+		normalized[k] = v
+	}
+	return normalized
+}
+
 // Patches Patch slince
 type Patches []Patch
 
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSetAnnotationPrefixes check keys are written under the primary prefix and read under every prefix
+func TestSetAnnotationPrefixes(t *testing.T) {
+	defer SetAnnotationPrefixes(nil) //nolint:errcheck
+
+	for _, prefixes := range [][]string{{"Timezone.Example.com"}, {"tz.example.com", "tz.example.com"}} {
+		if err := SetAnnotationPrefixes(prefixes); err == nil {
+			t.Fatalf("expected prefixes %v rejected", prefixes)
+		}
+	}
+
+	if err := SetAnnotationPrefixes([]string{"tz.example.com", DefaultAnnotationPrefix}); err != nil {
+		t.Fatal(err)
+	}
+	if TimezoneAnnotation != "tz.example.com/timezone" || AnnotationName(TimezoneAnnotation) != "timezone" {
+		t.Fatalf("expected timezone annotation under primary prefix, got %s", TimezoneAnnotation)
+	}
+	if aliases := AnnotationAliases(TimezoneAnnotation); !reflect.DeepEqual(aliases, []string{"tz.example.com/timezone", DefaultAnnotationPrefix + "/timezone"}) {
+		t.Fatalf("unexpected aliases %v", aliases)
+	}
+
+	legacy := map[string]string{DefaultAnnotationPrefix + "/timezone": "Asia/Tokyo"}
+	if timezone, ok := LookupAnnotation(legacy, TimezoneAnnotation); !ok || timezone != "Asia/Tokyo" {
+		t.Fatalf("expected timezone read under legacy prefix, got %q", timezone)
+	}
+	both := map[string]string{DefaultAnnotationPrefix + "/timezone": "Asia/Tokyo", "tz.example.com/timezone": "UTC"}
+	if timezone, _ := LookupAnnotation(both, TimezoneAnnotation); timezone != "UTC" {
+		t.Fatalf("expected primary prefix wins, got %q", timezone)
+	}
+	if normalized := NormalizeAnnotations(both); normalized[TimezoneAnnotation] != "UTC" {
+		t.Fatalf("expected primary prefix wins when normalized, got %v", normalized)
+	}
+	if normalized := NormalizeAnnotations(legacy); normalized[TimezoneAnnotation] != "Asia/Tokyo" {
+		t.Fatalf("expected legacy key renamed to primary prefix, got %v", normalized)
+	}
+}